@@ -0,0 +1,286 @@
+package mobiledoc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// asciidocHeadings maps heading tags to section titles. AsciiDoc has no
+// level below five, and level zero is reserved for the document title.
+var asciidocHeadings = map[string]string{
+	H1: "== ",
+	H2: "=== ",
+	H3: "==== ",
+	H4: "===== ",
+	H5: "====== ",
+	H6: "====== ",
+}
+
+// asciidocEscaper replaces the characters that start inline formatting,
+// passthroughs, attribute references and macros with character references,
+// which AsciiDoc writes as they are
+var asciidocEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"*", "&#42;",
+	"_", "&#95;",
+	"#", "&#35;",
+	"`", "&#96;",
+	"+", "&#43;",
+	"{", "&#123;",
+	"^", "&#94;",
+	"~", "&#126;",
+	"[", "&#91;",
+	"]", "&#93;",
+	"\\", "&#92;",
+)
+
+// asciidocLineStarts are the characters that start a block when they start a
+// line, such as titles, headings, lists and comments
+const asciidocLineStarts = ".=-/:|<>'0123456789"
+
+// asciidocText escapes the text n, including its first character when it
+// starts a line.
+func (n *node) asciidocText() string {
+	s := asciidocEscaper.Replace(n.value)
+	if n.startsLine() && s != "" && strings.ContainsRune(asciidocLineStarts, rune(s[0])) {
+		s = fmt.Sprintf("&#%d;", s[0]) + s[1:]
+	}
+	return s
+}
+
+// asciidocTitle escapes the block title s, which must fit on one line.
+func asciidocTitle(s string) string {
+	return asciidocEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
+
+// asciidocCards are the cards rendered natively to AsciiDoc, unless replaced
+// by a registered card of the same name
+var asciidocCards = map[string]Card{
+	"code": asciidocCodeCard,
+}
+
+// asciidocDelimiter returns a block delimiter made of c that is longer than
+// any line of content made only of c.
+func asciidocDelimiter(c, content string) string {
+	delimiter := strings.Repeat(c, 4)
+	for _, line := range strings.Split(content, "\n") {
+		if len(line) >= len(delimiter) &&
+			strings.Trim(line, c) == "" {
+			delimiter = strings.Repeat(c, len(line)+1)
+		}
+	}
+	return delimiter
+}
+
+func asciidocCodeCard(payload interface{}) string {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, _ := payloadString(m, "code")
+
+	var b strings.Builder
+	if caption, ok := payloadString(m, "caption"); ok {
+		fmt.Fprintf(&b, ".%s\n", asciidocTitle(caption))
+	}
+	if language, ok := payloadString(m, "language"); ok {
+		fmt.Fprintf(&b, "[source,%s]\n", language)
+	}
+	delimiter := asciidocDelimiter("-", code)
+	fmt.Fprintf(&b, "%s\n%s\n%s", delimiter, code, delimiter)
+	return b.String()
+}
+
+// asciidocAttributeValue quotes an attribute value of a macro.
+func asciidocAttributeValue(v string) string {
+	return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+}
+
+// asciidocPositional formats the first positional attribute of a macro,
+// quoting it when it would otherwise be split into more attributes.
+func asciidocPositional(v string) string {
+	if strings.ContainsAny(v, `,="`) {
+		return asciidocAttributeValue(v)
+	}
+	return strings.ReplaceAll(v, "]", `\]`)
+}
+
+func (n *node) renderAsciiDocImage(w io.Writer) error {
+	if caption, ok := n.attributes["caption"]; ok {
+		if _, err := fmt.Fprintf(w, ".%s\n", asciidocTitle(caption)); err != nil {
+			return err
+		}
+	}
+
+	attributes := []string{asciidocPositional(n.attributes["alt"])}
+	for _, k := range []string{"width", "height", "title"} {
+		if v, ok := n.attributes[k]; ok {
+			attributes = append(
+				attributes, k+"="+asciidocAttributeValue(v),
+			)
+		}
+	}
+	_, err := fmt.Fprintf(
+		w, "image::%s[%s]\n\n",
+		n.attributes["src"], strings.Join(attributes, ","),
+	)
+	return err
+}
+
+func (n *node) renderAsciiDocLink(w io.Writer) error {
+	var text bytes.Buffer
+	if err := n.renderAsciiDocContent(&text); err != nil {
+		return err
+	}
+
+	attributes := []string{asciidocPositional(text.String())}
+	if title, ok := n.attributes["title"]; ok {
+		attributes = append(attributes, "title="+asciidocAttributeValue(title))
+	}
+	if target, ok := n.attributes["target"]; ok {
+		attributes = append(attributes, "window="+asciidocAttributeValue(target))
+	}
+	_, err := fmt.Fprintf(
+		w, "link:%s[%s]",
+		n.attributes["href"], strings.Join(attributes, ","),
+	)
+	return err
+}
+
+func (n *node) renderAsciiDocStart(w io.Writer) error {
+	var err error
+	if align := n.attributes[textAlignAttribute]; textAlignments[align] &&
+		n.isMarkupSection() {
+		if _, err = fmt.Fprintf(w, "[.text-%s]\n", align); err != nil {
+			return err
+		}
+	}
+
+	tag := strings.ToLower(n.tagname)
+	switch tag {
+	case BOLD, STRONG:
+		_, err = fmt.Fprint(w, "**")
+	case CODE:
+		_, err = fmt.Fprint(w, "``")
+	case ITALIC, EMPHASIS:
+		_, err = fmt.Fprint(w, "__")
+	case UNDERLINE:
+		_, err = fmt.Fprint(w, "[.underline]##")
+	case STRIKETHROUGH:
+		_, err = fmt.Fprint(w, "[.line-through]##")
+	case SUBSCRIPT:
+		_, err = fmt.Fprint(w, "~")
+	case SUPERSCRIPT:
+		_, err = fmt.Fprint(w, "^")
+	case H1, H2, H3, H4, H5, H6:
+		_, err = fmt.Fprint(w, asciidocHeadings[tag])
+	case ORDEREDLIST, UNORDEREDLIST:
+		// a comment line keeps a list from continuing the one before it
+		if n.prevSibling.isList() {
+			_, err = fmt.Fprint(w, "//\n\n")
+		}
+	case LISTITEM:
+		marker := "*"
+		if _, ok := n.attributes["position"]; ok {
+			marker = "."
+		}
+		_, err = fmt.Fprint(w, strings.Repeat(marker, n.listDepth()), " ")
+	case BLOCKQUOTE:
+		_, err = fmt.Fprint(w, "____\n")
+	case ASIDE:
+		_, err = fmt.Fprint(w, "****\n")
+	case BREAK:
+		_, err = fmt.Fprint(w, n.lineBreak(" +\n"))
+	}
+	return err
+}
+
+func (n *node) renderAsciiDocEnd(w io.Writer) error {
+	var err error
+	switch strings.ToLower(n.tagname) {
+	case BOLD, STRONG:
+		_, err = fmt.Fprint(w, "**")
+	case CODE:
+		_, err = fmt.Fprint(w, "``")
+	case ITALIC, EMPHASIS:
+		_, err = fmt.Fprint(w, "__")
+	case UNDERLINE, STRIKETHROUGH:
+		_, err = fmt.Fprint(w, "##")
+	case SUBSCRIPT:
+		_, err = fmt.Fprint(w, "~")
+	case SUPERSCRIPT:
+		_, err = fmt.Fprint(w, "^")
+	case LISTITEM:
+		// a nested list already ends the line
+		if !n.lastChild.isList() {
+			_, err = fmt.Fprint(w, "\n")
+		}
+	case ORDEREDLIST, UNORDEREDLIST:
+		if n.parent == nil || strings.ToLower(n.parent.tagname) != LISTITEM {
+			_, err = fmt.Fprint(w, "\n")
+		}
+	case BLOCKQUOTE:
+		_, err = fmt.Fprint(w, "\n____\n\n")
+	case ASIDE:
+		_, err = fmt.Fprint(w, "\n****\n\n")
+	case H1, H2, H3, H4, H5, H6, PARAGRAPH:
+		_, err = fmt.Fprint(w, "\n\n")
+	default:
+		// other sections are written as paragraphs
+		if n.parent != nil && n.parent.tagname == rootTag {
+			_, err = fmt.Fprint(w, "\n\n")
+		}
+	}
+	return err
+}
+
+func (n *node) renderAsciiDocContent(w io.Writer) error {
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if c.isList() && strings.ToLower(n.tagname) == LISTITEM {
+			// nested lists start on their own line
+			if _, err := fmt.Fprint(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := c.renderAsciiDoc(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *node) renderAsciiDoc(w io.Writer) error {
+	var err error
+	switch strings.ToLower(n.tagname) {
+	case TEXT:
+		_, err = fmt.Fprint(w, n.asciidocText())
+		return err
+	case rawTag:
+		_, err = fmt.Fprint(w, n.value)
+		return err
+	case rootTag:
+		return n.renderAsciiDocContent(w)
+	case cardTag:
+		if err = n.renderAsciiDocContent(w); err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, "\n\n")
+		return err
+	case IMAGE:
+		return n.renderAsciiDocImage(w)
+	case ANCHOR:
+		return n.renderAsciiDocLink(w)
+	}
+
+	if err = n.renderAsciiDocStart(w); err != nil {
+		return err
+	}
+
+	if err = n.renderAsciiDocContent(w); err != nil {
+		return err
+	}
+
+	return n.renderAsciiDocEnd(w)
+}
@@ -0,0 +1,200 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Asset is a media file referenced by a document, along with where it was
+// found
+type Asset struct {
+	URL string
+	// Section is the index of the top level section referencing the asset
+	Section int
+	// Card is the name of the card and Key the payload field holding the
+	// URL, both empty for an image section
+	Card, Key string
+}
+
+// cardAssetKeys are the payload fields holding media URLs for each card
+var cardAssetKeys = map[string][]string{
+	"image":      {"src"},
+	"image-card": {"src"},
+	"video":      {"src", "thumbnailSrc"},
+	"audio":      {"src", "thumbnailSrc"},
+	"file":       {"src"},
+}
+
+// Assets returns the media files of the document in document order, which
+// may include the same URL more than once
+func Assets(d *Document) []Asset {
+	var assets []Asset
+	_ = visitAssets(d, func(a Asset) (string, error) {
+		assets = append(assets, a)
+		return a.URL, nil
+	})
+	return assets
+}
+
+// visitAssets calls fn for every asset of d, setting the URL of the asset
+// to the one returned.
+func visitAssets(d *Document, fn func(a Asset) (string, error)) error {
+	// visit replaces the URL held by the key of m
+	visit := func(m map[string]interface{}, k string, a Asset) error {
+		u, ok := m[k].(string)
+		if !ok || u == "" {
+			return nil
+		}
+		a.URL = u
+		u, err := fn(a)
+		if err != nil {
+			return err
+		}
+		m[k] = u
+		return nil
+	}
+
+	for i, s := range d.Sections {
+		switch s := s.(type) {
+		case *ImageSection:
+			src, err := fn(Asset{URL: s.Src, Section: i})
+			if err != nil {
+				return err
+			}
+			s.Src = src
+		case *CardSection:
+			m, ok := s.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			for _, k := range cardAssetKeys[s.Name] {
+				a := Asset{Section: i, Card: s.Name, Key: k}
+				if err := visit(m, k, a); err != nil {
+					return err
+				}
+			}
+			if s.Name != "gallery" {
+				break
+			}
+			images, _ := m["images"].([]interface{})
+			for j, image := range images {
+				im, ok := image.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				key := fmt.Sprintf("images[%d].src", j)
+				a := Asset{Section: i, Card: s.Name, Key: key}
+				if err := visit(im, "src", a); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Fetcher retrieves the content of assets
+type Fetcher interface {
+	Fetch(url string) (io.ReadCloser, error)
+}
+
+// FetcherFunc adapts a function to a Fetcher
+type FetcherFunc func(url string) (io.ReadCloser, error)
+
+// Fetch calls fn
+func (fn FetcherFunc) Fetch(url string) (io.ReadCloser, error) {
+	return fn(url)
+}
+
+// DirFetcher returns a Fetcher reading assets from dir, using the path of
+// their URL below dir, such as the content directory of a Ghost export
+func DirFetcher(dir string) Fetcher {
+	return FetcherFunc(func(rawurl string) (io.ReadCloser, error) {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.FromSlash(path.Clean("/" + u.Path))
+		return os.Open(filepath.Join(dir, name))
+	})
+}
+
+// Localize returns a Transform that fetches the assets of the document into
+// dir, replacing their URLs with prefix followed by the file name. Assets
+// with the same file name but different URLs are given distinct names.
+func Localize(fetcher Fetcher, dir, prefix string) Transform {
+	return func(d *Document) error {
+		files := make(map[string]string) // URL to file name
+		used := make(map[string]bool)
+		return visitAssets(d, func(a Asset) (string, error) {
+			name, ok := files[a.URL]
+			if !ok {
+				name = uniqueName(assetName(a.URL), used)
+				err := fetchAsset(fetcher, a.URL, filepath.Join(dir, name))
+				if err != nil {
+					return "", fmt.Errorf("unable to fetch asset %q: %w", a.URL, err)
+				}
+				files[a.URL] = name
+				used[name] = true
+			}
+			return assetURL(prefix, name), nil
+		})
+	}
+}
+
+// assetURL returns the URL of the file name under prefix, which is kept as
+// it is, being a URL or a path.
+func assetURL(prefix, name string) string {
+	name = url.PathEscape(name)
+	if prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
+
+// assetName returns the file name at the end of the path of rawurl, or
+// "asset" when it has none or it would name a file outside the directory.
+func assetName(rawurl string) string {
+	name := "asset"
+	if u, err := url.Parse(rawurl); err == nil {
+		base := path.Base(u.Path)
+		if base != "." && base != ".." && base != "/" &&
+			!strings.Contains(base, `\`) {
+			name = base
+		}
+	}
+	return name
+}
+
+// uniqueName returns name, numbered before its extension if it is used.
+func uniqueName(name string, used map[string]bool) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	return name
+}
+
+func fetchAsset(fetcher Fetcher, rawurl, file string) error {
+	r, err := fetcher.Fetch(rawurl)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -9,6 +9,16 @@ import (
 // Atom renders an Atom
 type Atom func(value string, payload interface{}) string
 
+// atomRenderer renders an atom to a format, failing when it is unable to
+type atomRenderer func(a *atom, format Format) (string, error)
+
+// renderer adapts the Atom to an atomRenderer
+func (fn Atom) renderer() atomRenderer {
+	return func(a *atom, _ Format) (string, error) {
+		return fn(a.value, a.payload), nil
+	}
+}
+
 type atom struct {
 	name    string
 	value   string
@@ -45,15 +55,25 @@ func (a *atom) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (md *Mobiledoc) renderAtom(a *atom) (*node, error) {
-	if md.atoms == nil {
-		return nil, fmt.Errorf("unable to locate renderer for atom %q", a.name)
+// lookupAtom finds the renderer for the named atom in the current format
+func (md *Mobiledoc) lookupAtom(name string) (atomRenderer, bool) {
+	if renderer, ok := md.formatAtoms[md.format][name]; ok {
+		return renderer, true
 	}
+	renderer, ok := md.atoms[name]
+	return renderer, ok
+}
 
-	renderer, ok := md.atoms[a.name]
+func (md *Mobiledoc) renderAtom(a *atom) (*node, error) {
+	renderer, ok := md.lookupAtom(a.name)
 	if !ok {
 		return nil, fmt.Errorf("unable to locate renderer for atom %q", a.name)
 	}
 
-	return newNode("", renderer(a.value, a.payload)), nil
+	value, err := renderer(a, md.format)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render atom %q: %w", a.name, err)
+	}
+
+	return newNode(rawTag, value), nil
 }
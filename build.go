@@ -0,0 +1,113 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// buildTree builds the nodes rendered for document, rendering its cards and
+// atoms to the current format.
+func (md *Mobiledoc) buildTree(document *Document) (*node, error) {
+	root := newNode(rootTag, "")
+	var ids map[int]string
+	if md.headingSlug != nil {
+		ids = headingIDs(document, md.headingSlug)
+	}
+	for i, s := range document.Sections {
+		n, err := md.buildSection(s)
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			continue
+		}
+		n.id = ids[i]
+		root.appendChild(n)
+	}
+	return root, nil
+}
+
+func (md *Mobiledoc) buildSection(s Section) (*node, error) {
+	switch s := s.(type) {
+	case *MarkupSection:
+		n := newNode(s.Tag, "")
+		for k, v := range s.Attributes {
+			n.addAttribute(k, v)
+		}
+		return n, md.buildInlines(n, s.Children)
+	case *ListSection:
+		return md.buildList(s)
+	case *ImageSection:
+		n := newNode(IMAGE, "")
+		n.addAttribute("src", s.Src)
+		return n, nil
+	case *CardSection:
+		return md.renderCard(&card{name: s.Name, payload: s.Payload})
+	}
+	return nil, fmt.Errorf("unknown section %T", s)
+}
+
+func (md *Mobiledoc) buildList(l *ListSection) (*node, error) {
+	n := newNode(l.Tag, "")
+	for i, item := range l.Items {
+		li := newNode(LISTITEM, "")
+		if l.Tag == ORDEREDLIST {
+			li.addAttribute("position", strconv.Itoa(i+1))
+		}
+		if err := md.buildInlines(li, item.Children); err != nil {
+			return nil, err
+		}
+		for _, nested := range item.Lists {
+			c, err := md.buildList(nested)
+			if err != nil {
+				return nil, err
+			}
+			li.appendChild(c)
+		}
+		n.appendChild(li)
+	}
+	return n, nil
+}
+
+func (md *Mobiledoc) buildInlines(n *node, inlines []Inline) error {
+	for _, i := range inlines {
+		switch i := i.(type) {
+		case *TextNode:
+			n.appendChild(newNode(TEXT, i.Value))
+		case *Markup:
+			c := newNode(i.Tag, "")
+			for k, v := range i.Attributes {
+				c.addAttribute(k, v)
+			}
+			if err := md.buildInlines(c, i.Children); err != nil {
+				return err
+			}
+			n.appendChild(c)
+		case *BreakNode:
+			// a registered soft-return atom replaces the native line break,
+			// as registered cards replace the built-in ones
+			if _, ok := md.lookupAtom(softReturnAtom); ok {
+				c, err := md.renderAtom(&atom{
+					name: softReturnAtom, payload: map[string]interface{}{},
+				})
+				if err != nil {
+					return err
+				}
+				n.appendChild(c)
+				break
+			}
+			n.appendChild(newNode(BREAK, ""))
+		case *AtomNode:
+			c, err := md.renderAtom(
+				&atom{name: i.Name, value: i.Value, payload: i.Payload},
+			)
+			if err != nil {
+				return err
+			}
+			n.appendChild(c)
+		default:
+			return fmt.Errorf("unknown inline %T", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package mobiledoc
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Builder builds a Document section by section
+//
+//	doc := NewBuilder().
+//		Heading(2, "Title").
+//		Paragraph(Text("a "), Bold("b"), Link("c", "https://example.com")).
+//		List(false, Item(Text("one")), Item(Text("two"))).
+//		Card("code", map[string]interface{}{"code": "x := 1"}).
+//		Document()
+type Builder struct {
+	document Document
+}
+
+// NewBuilder creates a Builder for an empty document
+func NewBuilder() *Builder {
+	return &Builder{document: Document{Version: encodeVersion}}
+}
+
+// Section adds a markup section with the tag, such as p or h2
+func (b *Builder) Section(tag string, content ...Inline) *Builder {
+	b.document.Sections = append(
+		b.document.Sections, &MarkupSection{Tag: tag, Children: content},
+	)
+	return b
+}
+
+// Heading adds a heading of the level, from 1 to 6, with the text
+func (b *Builder) Heading(level int, text string) *Builder {
+	return b.Section(fmt.Sprintf("h%d", level), Text(text))
+}
+
+// Paragraph adds a paragraph
+func (b *Builder) Paragraph(content ...Inline) *Builder {
+	return b.Section(PARAGRAPH, content...)
+}
+
+// Quote adds a block quote
+func (b *Builder) Quote(content ...Inline) *Builder {
+	return b.Section(BLOCKQUOTE, content...)
+}
+
+// List adds an ordered or unordered list
+func (b *Builder) List(ordered bool, items ...*ListItem) *Builder {
+	b.document.Sections = append(b.document.Sections, newList(ordered, items))
+	return b
+}
+
+// Image adds an image section
+func (b *Builder) Image(src string) *Builder {
+	b.document.Sections = append(b.document.Sections, &ImageSection{Src: src})
+	return b
+}
+
+// Card adds a card with the payload, which must encode to JSON
+func (b *Builder) Card(name string, payload interface{}) *Builder {
+	b.document.Sections = append(
+		b.document.Sections, &CardSection{Name: name, Payload: payload},
+	)
+	return b
+}
+
+// Document returns the document built so far
+func (b *Builder) Document() *Document {
+	return &b.document
+}
+
+// Mobiledoc returns a Mobiledoc instance for the document built so far, to
+// be rendered like any other
+func (b *Builder) Mobiledoc() (Mobiledoc, error) {
+	src, err := b.document.MarshalMobiledoc()
+	if err != nil {
+		return Mobiledoc{}, fmt.Errorf("unable to encode mobiledoc: %w", err)
+	}
+	return NewMobiledoc(bytes.NewReader(src)), nil
+}
+
+func newList(ordered bool, items []*ListItem) *ListSection {
+	tag := UNORDEREDLIST
+	if ordered {
+		tag = ORDEREDLIST
+	}
+	return &ListSection{Tag: tag, Items: items}
+}
+
+// Item creates a list item
+func Item(content ...Inline) *ListItem {
+	return &ListItem{Children: content}
+}
+
+// Nest adds a list nested in the item, returning the item
+func (li *ListItem) Nest(ordered bool, items ...*ListItem) *ListItem {
+	li.Lists = append(li.Lists, newList(ordered, items))
+	return li
+}
+
+// Text creates a run of text
+func Text(value string) *TextNode {
+	return &TextNode{Value: value}
+}
+
+// NewMarkup creates a markup with the tag and attributes applied to the
+// content
+func NewMarkup(
+	tag string, attributes map[string]string, content ...Inline,
+) *Markup {
+	return &Markup{Tag: tag, Attributes: attributes, Children: content}
+}
+
+// Bold creates bold text
+func Bold(text string) *Markup {
+	return NewMarkup(STRONG, nil, Text(text))
+}
+
+// Italic creates emphasized text
+func Italic(text string) *Markup {
+	return NewMarkup(EMPHASIS, nil, Text(text))
+}
+
+// Code creates inline code
+func Code(text string) *Markup {
+	return NewMarkup(CODE, nil, Text(text))
+}
+
+// Link creates a link with the text to href
+func Link(text, href string) *Markup {
+	return NewMarkup(ANCHOR, map[string]string{"href": href}, Text(text))
+}
+
+// NewAtom creates an atom with the value and payload
+func NewAtom(name, value string, payload interface{}) *AtomNode {
+	return &AtomNode{Name: name, Value: value, Payload: payload}
+}
@@ -4,21 +4,68 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 )
 
 // Card renders a Card
 type Card func(payload interface{}) string
 
-func imagecard(payload interface{}) string {
-	m, ok := payload.(map[string]interface{})
-	if !ok {
-		return ""
+// cardRenderer renders a card to a format, failing when it is unable to
+type cardRenderer func(c *card, format Format) (string, error)
+
+// renderer adapts the Card to a cardRenderer
+func (fn Card) renderer() cardRenderer {
+	return func(c *card, _ Format) (string, error) {
+		return fn(c.payload), nil
 	}
-	src, ok := m["src"]
+}
+
+// builtinCards build the nodes for the cards that are rendered natively,
+// unless replaced by a registered card of the same name
+var builtinCards = map[string]func(payload interface{}) (*node, error){
+	"image-card": imagecard,
+	"image":      imagecard,
+}
+
+// formatBuiltinCards are the cards rendered natively to a single format,
+// unless replaced by a registered card of the same name
+var formatBuiltinCards = map[Format]map[string]Card{
+	Markdown: markdownCards,
+	AsciiDoc: asciidocCards,
+	RST:      rstCards,
+	Org:      orgCards,
+	Gemtext:  gemtextCards,
+	LaTeX:    latexCards,
+}
+
+// payloadString returns the string form of a string or number payload field.
+func payloadString(m map[string]interface{}, key string) (string, bool) {
+	switch v := m[key].(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// imagecard models an image card as an image node, or as no node when the
+// card has no image, so that it is skipped
+func imagecard(payload interface{}) (*node, error) {
+	m, _ := payload.(map[string]interface{})
+	src, ok := payloadString(m, "src")
 	if !ok {
-		return ""
+		return nil, nil
+	}
+
+	n := newNode(IMAGE, "")
+	n.addAttribute("src", src)
+	for _, k := range imageAttributes {
+		if v, ok := payloadString(m, k); ok {
+			n.addAttribute(k, v)
+		}
 	}
-	return fmt.Sprintf("![](%s)", src.(string))
+	return n, nil
 }
 
 type card struct {
@@ -51,19 +98,48 @@ func (c *card) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// lookupCard finds the renderer for the named card in the current format
+func (md *Mobiledoc) lookupCard(name string) (cardRenderer, bool) {
+	if renderer, ok := md.formatCards[md.format][name]; ok {
+		return renderer, true
+	}
+	if renderer, ok := md.cards[name]; ok {
+		return renderer, true
+	}
+	if md.format == Markdown && md.opts.hugo != nil {
+		if renderer, ok := md.opts.hugo.card(name, &md.opts); ok {
+			return renderer, true
+		}
+	}
+	if md.format == HTML && name == "code" {
+		return htmlCodeCard(md.opts.highlighter), true
+	}
+	if renderer, ok := md.embeddedCard(name); ok {
+		return renderer, true
+	}
+	if card, ok := formatBuiltinCards[md.format][name]; ok {
+		return card.renderer(), true
+	}
+	return nil, false
+}
+
 // Render the card to the specified format
 func (md *Mobiledoc) renderCard(c *card) (*node, error) {
-	if md.cards == nil {
+	renderer, ok := md.lookupCard(c.name)
+	if !ok {
+		if builtin, ok := builtinCards[c.name]; ok {
+			return builtin(c.payload)
+		}
 		return nil, fmt.Errorf("unable to locate renderer for card %q", c.name)
 	}
 
-	renderer, ok := md.cards[c.name]
-	if !ok {
-		return nil, fmt.Errorf("unable to locate renderer for card %q", c.name)
+	value, err := renderer(c, md.format)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render card %q: %w", c.name, err)
 	}
 
-	wrapper := newNode("div", "")
-	render := newNode("", renderer(c.payload))
+	wrapper := newNode(cardTag, "")
+	render := newNode(rawTag, value)
 	wrapper.appendChild(render)
 
 	return wrapper, nil
@@ -0,0 +1,97 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// markdownCards are the cards rendered natively to Markdown, unless
+// replaced by a registered card of the same name
+var markdownCards = map[string]Card{
+	"code": markdownCodeCard,
+}
+
+// codePayload returns the code, language and caption of a code card.
+func codePayload(payload interface{}) (code, language, caption string) {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return "", "", ""
+	}
+	code, _ = payloadString(m, "code")
+	language, _ = payloadString(m, "language")
+	caption, _ = payloadString(m, "caption")
+	return code, language, caption
+}
+
+// longestRun returns the length of the longest run of c in s.
+func longestRun(s string, c rune) int {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r != c {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// codeFence returns a fence for a Markdown code block that is longer than
+// any run of its character in code, so that the code can not close it.
+// Tildes are used when the info string contains a backtick, which is not
+// allowed after a backtick fence.
+func codeFence(code, info string) string {
+	c := '`'
+	if strings.ContainsRune(info, '`') {
+		c = '~'
+	}
+	n := longestRun(code, c) + 1
+	if n < 3 {
+		n = 3
+	}
+	return strings.Repeat(string(c), n)
+}
+
+func markdownCodeCard(payload interface{}) string {
+	code, language, caption := codePayload(payload)
+	fence := codeFence(code, language)
+	block := fmt.Sprintf("%s%s\n%s\n%s", fence, language, code, fence)
+	if caption != "" {
+		block += "\n\n" + markdownCaption(caption)
+	}
+	return block
+}
+
+// htmlCodeCard returns the renderer of code cards to HTML, highlighting the
+// code with h unless it is nil. Captioned code is written as a figure, as
+// Ghost does.
+func htmlCodeCard(h Highlighter) cardRenderer {
+	return func(c *card, _ Format) (string, error) {
+		code, language, caption := codePayload(c.payload)
+
+		body := html.EscapeString(code)
+		if h != nil {
+			var err error
+			if body, err = h.Highlight(code, language); err != nil {
+				return "", fmt.Errorf("unable to highlight code: %w", err)
+			}
+		}
+
+		class := ""
+		if language != "" {
+			class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(language))
+		}
+		block := fmt.Sprintf("<pre><code%s>%s</code></pre>", class, body)
+		if caption == "" {
+			return block, nil
+		}
+		return fmt.Sprintf(
+			`<figure class="kg-card kg-code-card">%s<figcaption>%s</figcaption></figure>`,
+			block, html.EscapeString(caption),
+		), nil
+	}
+}
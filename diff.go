@@ -0,0 +1,563 @@
+package mobiledoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ChangeKind identifies how part of a document changed
+type ChangeKind int
+
+// Change kinds
+const (
+	Equal ChangeKind = iota
+	Inserted
+	Removed
+	// Modified sections are in both documents, with changes to their text or
+	// markups
+	Modified
+)
+
+// String returns the name of the kind
+func (k ChangeKind) String() string {
+	switch k {
+	case Equal:
+		return "equal"
+	case Inserted:
+		return "inserted"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// SectionDiff is the change to a section between two documents
+type SectionDiff struct {
+	Kind ChangeKind
+	// From and To are the section in each document, with From nil for an
+	// inserted section and To nil for a removed one
+	From, To Section
+	// Words are the changes to the text of a modified markup or list
+	// section, with the items of a list separated by newlines that, unlike
+	// line breaks, are not marked as a Break
+	Words []WordDiff
+}
+
+// WordDiff is a change to a word, or the whitespace between words, of a
+// modified section. A word whose markups changed is removed with the old
+// markups and inserted with the new ones.
+type WordDiff struct {
+	Kind ChangeKind
+	Text string
+	// Markups are the markups applied to the text, outermost first, without
+	// their children
+	Markups []*Markup
+	// Break is set for a line break within the text, whose Text is a
+	// newline like the one separating list items
+	Break bool
+}
+
+// Diff compares two documents section by section. Sections in both
+// documents are matched in order, and an unmatched markup or list section
+// in place of another one of the same kind is modified rather than removed
+// and inserted.
+func Diff(from, to *Document) []SectionDiff {
+	fromKeys := sectionKeys(from.Sections)
+	toKeys := sectionKeys(to.Sections)
+
+	var diffs []SectionDiff
+	var removed, inserted []Section
+	// flush pairs the sections removed and inserted since the last match
+	flush := func() {
+		for len(removed) > 0 || len(inserted) > 0 {
+			switch {
+			case len(removed) > 0 && len(inserted) > 0 &&
+				comparable(removed[0], inserted[0]):
+				diffs = append(diffs, SectionDiff{
+					Kind: Modified, From: removed[0], To: inserted[0],
+					Words: diffWords(
+						sectionTokens(removed[0]), sectionTokens(inserted[0]),
+					),
+				})
+				removed, inserted = removed[1:], inserted[1:]
+			case len(removed) > 0:
+				diffs = append(diffs, SectionDiff{Kind: Removed, From: removed[0]})
+				removed = removed[1:]
+			default:
+				diffs = append(diffs, SectionDiff{Kind: Inserted, To: inserted[0]})
+				inserted = inserted[1:]
+			}
+		}
+	}
+
+	for _, op := range lcs(len(fromKeys), len(toKeys), func(i, j int) bool {
+		return fromKeys[i] == toKeys[j]
+	}) {
+		switch op.kind {
+		case Equal:
+			flush()
+			diffs = append(diffs, SectionDiff{
+				Kind: Equal, From: from.Sections[op.i], To: to.Sections[op.j],
+			})
+		case Removed:
+			removed = append(removed, from.Sections[op.i])
+		case Inserted:
+			inserted = append(inserted, to.Sections[op.j])
+		}
+	}
+	flush()
+	return diffs
+}
+
+// sectionKeys returns strings that are equal for equal sections.
+func sectionKeys(sections []Section) []string {
+	keys := make([]string, len(sections))
+	for i, s := range sections {
+		b, err := json.Marshal(s)
+		if err != nil {
+			// payloads that can not be encoded never match
+			keys[i] = fmt.Sprintf("%p", s)
+			continue
+		}
+		keys[i] = string(b)
+	}
+	return keys
+}
+
+// comparable reports whether a section may be modified into the other.
+func comparable(a, b Section) bool {
+	switch a.(type) {
+	case *MarkupSection:
+		_, ok := b.(*MarkupSection)
+		return ok
+	case *ListSection:
+		_, ok := b.(*ListSection)
+		return ok
+	}
+	return false
+}
+
+// edit is an operation turning one sequence into another, with i and j
+// indexes into the sequences
+type edit struct {
+	kind ChangeKind
+	i, j int
+}
+
+// lcs returns the edits turning a sequence of length n into one of length m
+// with the fewest insertions and removals, removals first.
+func lcs(n, m int, equal func(i, j int) bool) []edit {
+	// lengths[i][j] is the length of the longest common subsequence of the
+	// sequences from i and j
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case equal(i, j):
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && equal(i, j):
+			edits = append(edits, edit{Equal, i, j})
+			i++
+			j++
+		case i < n && (j == m || lengths[i+1][j] >= lengths[i][j+1]):
+			edits = append(edits, edit{Removed, i, j})
+			i++
+		default:
+			edits = append(edits, edit{Inserted, i, j})
+			j++
+		}
+	}
+	return edits
+}
+
+// token is a word or whitespace of a section along with its markups
+type token struct {
+	text    string
+	markups []*Markup
+	key     string
+	// lineBreak is set for a line break rather than text
+	lineBreak bool
+}
+
+// sectionTokens splits the text of a markup or list section into tokens.
+func sectionTokens(s Section) []token {
+	var tokens []token
+	switch s := s.(type) {
+	case *MarkupSection:
+		tokens = inlineTokens(tokens, s.Children, nil)
+	case *ListSection:
+		for _, line := range listItems(s) {
+			if len(tokens) > 0 {
+				tokens = append(tokens, token{text: "\n", key: "\n"})
+			}
+			tokens = inlineTokens(tokens, line, nil)
+		}
+	}
+	return tokens
+}
+
+// listItems returns the content of the items of l and of the lists nested
+// in them.
+func listItems(l *ListSection) [][]Inline {
+	var items [][]Inline
+	for _, item := range l.Items {
+		items = append(items, item.Children)
+		for _, nested := range item.Lists {
+			items = append(items, listItems(nested)...)
+		}
+	}
+	return items
+}
+
+func inlineTokens(tokens []token, inlines []Inline, markups []*Markup) []token {
+	for _, i := range inlines {
+		switch i := i.(type) {
+		case *TextNode:
+			for _, word := range splitWords(i.Value) {
+				tokens = append(tokens, newToken(word, markups))
+			}
+		case *Markup:
+			m := &Markup{Tag: i.Tag, Attributes: i.Attributes}
+			chain := append(markups[:len(markups):len(markups)], m)
+			tokens = inlineTokens(tokens, i.Children, chain)
+		case *AtomNode:
+			tokens = append(tokens, newToken("{"+i.Name+":"+i.Value+"}", markups))
+		case *BreakNode:
+			t := newToken("\n", markups)
+			t.lineBreak = true
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+func newToken(text string, markups []*Markup) token {
+	var key strings.Builder
+	for _, m := range markups {
+		key.WriteString(markupKey(m))
+	}
+	key.WriteString("\x00")
+	key.WriteString(text)
+	return token{text: text, markups: markups, key: key.String()}
+}
+
+// markupKey returns a string that is equal for equal markups.
+func markupKey(m *Markup) string {
+	keys := make([]string, 0, len(m.Attributes))
+	for k := range m.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("<" + m.Tag)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, m.Attributes[k])
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// splitWords splits text into words and the whitespace between them, with
+// each Chinese or Japanese character a word of its own.
+func splitWords(text string) []string {
+	var words []string
+	start := 0
+	for i, r := range text {
+		if i == start {
+			continue
+		}
+		prev, _ := utf8.DecodeLastRuneInString(text[:i])
+		if unicode.IsSpace(prev) != unicode.IsSpace(r) ||
+			isIdeograph(prev) || isIdeograph(r) {
+			words = append(words, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+func diffWords(from, to []token) []WordDiff {
+	var words []WordDiff
+	for _, op := range lcs(len(from), len(to), func(i, j int) bool {
+		return from[i].key == to[j].key
+	}) {
+		var t token
+		if op.kind == Inserted {
+			t = to[op.j]
+		} else {
+			t = from[op.i]
+		}
+		words = append(words, WordDiff{
+			Kind: op.kind, Text: t.text, Markups: t.markups, Break: t.lineBreak,
+		})
+	}
+	return words
+}
+
+// htmlElement returns the element used for the tag in HTML.
+func htmlElement(tag string) string {
+	return newNode(tag, "").htmlTagName()
+}
+
+// diffTag returns the name of the section s in diff output.
+func diffTag(s Section) string {
+	switch s := s.(type) {
+	case *MarkupSection:
+		return s.Tag
+	case *ListSection:
+		return s.Tag
+	case *ImageSection:
+		return IMAGE
+	case *CardSection:
+		return "card:" + s.Name
+	}
+	return ""
+}
+
+// diffText returns the content of s in a unified diff.
+func diffText(s Section) string {
+	switch s := s.(type) {
+	case *ImageSection:
+		return s.Src
+	case *CardSection:
+		b, _ := json.Marshal(s.Payload)
+		return string(b)
+	}
+	var b strings.Builder
+	for _, t := range sectionTokens(s) {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// RenderUnifiedDiff writes the diff as text, with the lines of each section
+// starting with " ", "-", "+" or "~" for equal, removed, inserted and
+// modified sections followed by the tag of the section. Within modified
+// sections removed words are written as [-words-] and inserted words as
+// {+words+}, with the markups of the changed words written around them as
+// tags.
+func RenderUnifiedDiff(w io.Writer, diffs []SectionDiff) error {
+	for _, d := range diffs {
+		var marker, text string
+		var s Section
+		switch d.Kind {
+		case Equal:
+			marker, s, text = " ", d.To, diffText(d.To)
+		case Removed:
+			marker, s, text = "-", d.From, diffText(d.From)
+		case Inserted:
+			marker, s, text = "+", d.To, diffText(d.To)
+		case Modified:
+			marker, s, text = "~", d.To, unifiedWords(d)
+		}
+		tag := diffTag(s)
+		if d.Kind == Modified && diffTag(d.From) != tag {
+			tag = diffTag(d.From) + "->" + tag
+		}
+		for _, line := range strings.Split(text, "\n") {
+			if _, err := fmt.Fprintf(w, "%s %s %s\n", marker, tag, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unifiedWords returns the text of a modified section with its changes.
+func unifiedWords(d SectionDiff) string {
+	var b strings.Builder
+	kind := Equal
+	closeRun := func() {
+		switch kind {
+		case Removed:
+			b.WriteString("-]")
+		case Inserted:
+			b.WriteString("+}")
+		}
+	}
+	for _, word := range d.Words {
+		if word.Kind != kind {
+			closeRun()
+			kind = word.Kind
+			switch kind {
+			case Removed:
+				b.WriteString("[-")
+			case Inserted:
+				b.WriteString("{+")
+			}
+		}
+		if kind == Equal {
+			b.WriteString(word.Text)
+			continue
+		}
+		for _, m := range word.Markups {
+			b.WriteString(markupKey(m))
+		}
+		b.WriteString(word.Text)
+		for i := len(word.Markups) - 1; i >= 0; i-- {
+			b.WriteString("</" + word.Markups[i].Tag + ">")
+		}
+	}
+	closeRun()
+	return b.String()
+}
+
+// RenderHTMLDiff writes the diff as HTML, wrapping removed content in del
+// elements and inserted content in ins elements. Lists are written with
+// their nested items flattened, and cards as their payload.
+func RenderHTMLDiff(w io.Writer, diffs []SectionDiff) error {
+	for _, d := range diffs {
+		var err error
+		switch d.Kind {
+		case Equal:
+			err = renderHTMLDiffSection(w, d.To, "")
+		case Removed:
+			err = renderHTMLDiffSection(w, d.From, "del")
+		case Inserted:
+			err = renderHTMLDiffSection(w, d.To, "ins")
+		case Modified:
+			err = renderHTMLDiffWords(w, d.To, d.Words)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderHTMLDiffSection writes s inside the element wrap, unless empty.
+func renderHTMLDiffSection(w io.Writer, s Section, wrap string) error {
+	var words []WordDiff
+	for _, t := range sectionTokens(s) {
+		words = append(words, WordDiff{
+			Kind: Equal, Text: t.text, Markups: t.markups, Break: t.lineBreak,
+		})
+	}
+
+	var b strings.Builder
+	switch s := s.(type) {
+	case *ImageSection:
+		fmt.Fprintf(&b, `<img src="%s">`+"\n", html.EscapeString(s.Src))
+	case *CardSection:
+		fmt.Fprintf(
+			&b, `<pre data-card="%s">%s</pre>`+"\n",
+			html.EscapeString(s.Name), html.EscapeString(diffText(s)),
+		)
+	default:
+		if err := renderHTMLDiffWords(&b, s, words); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if wrap == "" {
+		_, err = fmt.Fprint(w, b.String())
+	} else {
+		_, err = fmt.Fprintf(w, "<%s>\n%s</%s>\n", wrap, b.String(), wrap)
+	}
+	return err
+}
+
+// renderHTMLDiffWords writes the section s with the words of its diff.
+func renderHTMLDiffWords(w io.Writer, s Section, words []WordDiff) error {
+	tag := htmlElement(diffTag(s))
+	_, isList := s.(*ListSection)
+
+	var b strings.Builder
+	b.WriteString("<" + tag + ">")
+	if isList {
+		b.WriteString("\n<li>")
+	}
+	kind := Equal
+	var open []*Markup
+	// setMarkups closes and opens markups until those of the word are open
+	setMarkups := func(markups []*Markup) {
+		same := 0
+		for same < len(open) && same < len(markups) &&
+			markupKey(open[same]) == markupKey(markups[same]) {
+			same++
+		}
+		for i := len(open) - 1; i >= same; i-- {
+			b.WriteString("</" + htmlElement(open[i].Tag) + ">")
+		}
+		for _, m := range markups[same:] {
+			n := newNode(m.Tag, "")
+			for k, v := range m.Attributes {
+				n.addAttribute(k, v)
+			}
+			b.WriteString("<" + n.htmlTagName())
+			_ = n.renderHTMLAttributes(&b)
+			b.WriteString(">")
+		}
+		open = markups
+	}
+	setKind := func(k ChangeKind) {
+		if k == kind {
+			return
+		}
+		setMarkups(nil)
+		switch kind {
+		case Removed:
+			b.WriteString("</del>")
+		case Inserted:
+			b.WriteString("</ins>")
+		}
+		switch k {
+		case Removed:
+			b.WriteString("<del>")
+		case Inserted:
+			b.WriteString("<ins>")
+		}
+		kind = k
+	}
+
+	for _, word := range words {
+		if isList && word.Text == "\n" && !word.Break {
+			setKind(Equal)
+			b.WriteString("</li>\n<li>")
+			continue
+		}
+		setKind(word.Kind)
+		setMarkups(word.Markups)
+		if word.Break {
+			b.WriteString("<br>")
+			continue
+		}
+		b.WriteString(html.EscapeString(word.Text))
+	}
+	setKind(Equal)
+	setMarkups(nil)
+	if isList {
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+
+	_, err := fmt.Fprint(w, b.String())
+	return err
+}
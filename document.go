@@ -0,0 +1,306 @@
+package mobiledoc
+
+import "encoding/json"
+
+// ASTVersion is the version of the JSON structure written by the JSON
+// format. It changes only when the structure changes in a way that breaks
+// existing consumers.
+const ASTVersion = 1
+
+// Document is a parsed Mobiledoc document, with cards and atoms left
+// unrendered.
+//
+// Written with the JSON format, a document is an object with these fields:
+//
+//	version        ASTVersion
+//	mobiledoc      version of the Mobiledoc the document was parsed from
+//	sections       array of sections
+//
+// Every section and inline value is an object with a "type" field naming
+// its kind, followed by the fields of the matching Go type in lower case:
+//
+//	{"type": "markup", "tag": "p", "attributes": {...}, "children": [...]}
+//	{"type": "list", "tag": "ul", "attributes": {...}, "items": [...]}
+//	{"type": "image", "src": "..."}
+//	{"type": "card", "name": "...", "payload": ...}
+//	{"type": "text", "value": "..."}
+//	{"type": "markup", "tag": "a", "attributes": {...}, "children": [...]}
+//	{"type": "atom", "name": "...", "value": "...", "payload": ...}
+//	{"type": "break"}
+//
+// List items are objects with "children" and, for nested lists, "lists".
+// Empty attributes, children and lists are left out.
+type Document struct {
+	Version  string
+	Sections []Section
+}
+
+// Section is a top level section of a Document: a *MarkupSection,
+// *ListSection, *ImageSection or *CardSection.
+type Section interface {
+	Element
+	section()
+}
+
+// Inline is the content of a markup section or list item: a *TextNode,
+// *Markup, *AtomNode or *BreakNode.
+type Inline interface {
+	Element
+	inline()
+}
+
+// MarkupSection is a block of text such as a paragraph or heading
+type MarkupSection struct {
+	Tag        string
+	Attributes map[string]string
+	Children   []Inline
+}
+
+// ListSection is an ordered or unordered list
+type ListSection struct {
+	Tag        string
+	Attributes map[string]string
+	Items      []*ListItem
+}
+
+// ListItem is an item of a list, which may contain nested lists
+type ListItem struct {
+	Children []Inline
+	Lists    []*ListSection
+}
+
+// ImageSection is an image
+type ImageSection struct {
+	Src string
+}
+
+// CardSection is a card along with the payload it is rendered from
+type CardSection struct {
+	Name    string
+	Payload interface{}
+}
+
+// TextNode is a run of text
+type TextNode struct {
+	Value string
+}
+
+// Markup applies an inline markup such as emphasis or a link to its
+// children
+type Markup struct {
+	Tag        string
+	Attributes map[string]string
+	Children   []Inline
+}
+
+// AtomNode is an atom along with the value and payload it is rendered from
+type AtomNode struct {
+	Name    string
+	Value   string
+	Payload interface{}
+}
+
+// BreakNode is a line break within a section, which Ghost inserts for
+// Shift+Enter as a soft-return atom. It is rendered with the soft-return
+// atom instead when one is registered.
+type BreakNode struct{}
+
+func (*MarkupSection) section() {}
+func (*ListSection) section()   {}
+func (*ImageSection) section()  {}
+func (*CardSection) section()   {}
+func (*TextNode) inline()       {}
+func (*Markup) inline()         {}
+func (*AtomNode) inline()       {}
+func (*BreakNode) inline()      {}
+
+// clone returns a deep copy of d, so that it can be changed without changing
+// d or the payloads of its cards and atoms.
+func (d *Document) clone() *Document {
+	c := &Document{Version: d.Version}
+	for _, s := range d.Sections {
+		c.Sections = append(c.Sections, cloneSection(s))
+	}
+	return c
+}
+
+func cloneSection(s Section) Section {
+	switch s := s.(type) {
+	case *MarkupSection:
+		return &MarkupSection{
+			Tag:        s.Tag,
+			Attributes: cloneAttributes(s.Attributes),
+			Children:   cloneInlines(s.Children),
+		}
+	case *ListSection:
+		return cloneList(s)
+	case *ImageSection:
+		return &ImageSection{Src: s.Src}
+	case *CardSection:
+		return &CardSection{Name: s.Name, Payload: clonePayload(s.Payload)}
+	}
+	return s
+}
+
+func cloneList(l *ListSection) *ListSection {
+	c := &ListSection{Tag: l.Tag, Attributes: cloneAttributes(l.Attributes)}
+	for _, item := range l.Items {
+		li := &ListItem{Children: cloneInlines(item.Children)}
+		for _, nested := range item.Lists {
+			li.Lists = append(li.Lists, cloneList(nested))
+		}
+		c.Items = append(c.Items, li)
+	}
+	return c
+}
+
+func cloneInlines(inlines []Inline) []Inline {
+	if inlines == nil {
+		return nil
+	}
+	c := make([]Inline, 0, len(inlines))
+	for _, i := range inlines {
+		switch i := i.(type) {
+		case *TextNode:
+			c = append(c, &TextNode{Value: i.Value})
+		case *Markup:
+			c = append(c, &Markup{
+				Tag:        i.Tag,
+				Attributes: cloneAttributes(i.Attributes),
+				Children:   cloneInlines(i.Children),
+			})
+		case *AtomNode:
+			c = append(c, &AtomNode{
+				Name: i.Name, Value: i.Value, Payload: clonePayload(i.Payload),
+			})
+		case *BreakNode:
+			c = append(c, &BreakNode{})
+		default:
+			c = append(c, i)
+		}
+	}
+	return c
+}
+
+func cloneAttributes(attributes map[string]string) map[string]string {
+	if attributes == nil {
+		return nil
+	}
+	c := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		c[k] = v
+	}
+	return c
+}
+
+// clonePayload copies the objects and arrays of a payload decoded from JSON.
+func clonePayload(payload interface{}) interface{} {
+	switch p := payload.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(p))
+		for k, v := range p {
+			c[k] = clonePayload(v)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(p))
+		for i, v := range p {
+			c[i] = clonePayload(v)
+		}
+		return c
+	}
+	return payload
+}
+
+// MarshalJSON encodes the document with the ASTVersion
+func (d *Document) MarshalJSON() ([]byte, error) {
+	sections := d.Sections
+	if sections == nil {
+		sections = []Section{}
+	}
+	return json.Marshal(struct {
+		Version   int       `json:"version"`
+		Mobiledoc string    `json:"mobiledoc"`
+		Sections  []Section `json:"sections"`
+	}{ASTVersion, d.Version, sections})
+}
+
+// MarshalJSON encodes the section with its type
+func (s *MarkupSection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type       string            `json:"type"`
+		Tag        string            `json:"tag"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+		Children   []Inline          `json:"children,omitempty"`
+	}{"markup", s.Tag, s.Attributes, s.Children})
+}
+
+// MarshalJSON encodes the section with its type
+func (s *ListSection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type       string            `json:"type"`
+		Tag        string            `json:"tag"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+		Items      []*ListItem       `json:"items"`
+	}{"list", s.Tag, s.Attributes, s.Items})
+}
+
+// MarshalJSON encodes the list item
+func (li *ListItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Children []Inline       `json:"children,omitempty"`
+		Lists    []*ListSection `json:"lists,omitempty"`
+	}{li.Children, li.Lists})
+}
+
+// MarshalJSON encodes the section with its type
+func (s *ImageSection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Src  string `json:"src"`
+	}{"image", s.Src})
+}
+
+// MarshalJSON encodes the section with its type
+func (s *CardSection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type    string      `json:"type"`
+		Name    string      `json:"name"`
+		Payload interface{} `json:"payload"`
+	}{"card", s.Name, s.Payload})
+}
+
+// MarshalJSON encodes the text with its type
+func (t *TextNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}{"text", t.Value})
+}
+
+// MarshalJSON encodes the markup with its type
+func (m *Markup) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type       string            `json:"type"`
+		Tag        string            `json:"tag"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+		Children   []Inline          `json:"children,omitempty"`
+	}{"markup", m.Tag, m.Attributes, m.Children})
+}
+
+// MarshalJSON encodes the atom with its type
+func (a *AtomNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type    string      `json:"type"`
+		Name    string      `json:"name"`
+		Value   string      `json:"value"`
+		Payload interface{} `json:"payload"`
+	}{"atom", a.Name, a.Value, a.Payload})
+}
+
+// MarshalJSON encodes the line break with its type
+func (*BreakNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+	}{"break"})
+}
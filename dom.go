@@ -1,10 +1,21 @@
 package mobiledoc
 
+import "strings"
+
+// Internal node types that have no tag of their own in the output
+const (
+	rootTag = "#root"
+	rawTag  = "#raw"
+	cardTag = "#card"
+)
+
 type node struct {
 	parent, firstChild, lastChild, prevSibling, nextSibling *node
 
 	tagname, value string
 	attributes     map[string]string
+	// id is the anchor ID of a heading
+	id string
 }
 
 func newNode(tagname, value string) *node {
@@ -33,7 +44,129 @@ func (n *node) appendChild(c *node) {
 	c.prevSibling = last
 }
 
+// insertBefore inserts c as a child of n, immediately before ref, or at the
+// end when ref is nil.
+//
+// It will panic if c already has a parent or siblings.
+func (n *node) insertBefore(c, ref *node) {
+	if ref == nil {
+		n.appendChild(c)
+		return
+	}
+	if c.parent != nil || c.prevSibling != nil || c.nextSibling != nil {
+		panic("node: insertBefore called for an attached child Node")
+	}
+	prev := ref.prevSibling
+	if prev != nil {
+		prev.nextSibling = c
+	} else {
+		n.firstChild = c
+	}
+	ref.prevSibling = c
+	c.parent = n
+	c.prevSibling = prev
+	c.nextSibling = ref
+}
+
+// removeChild removes the child c of n, leaving it without a parent or
+// siblings.
+func (n *node) removeChild(c *node) {
+	if c.prevSibling != nil {
+		c.prevSibling.nextSibling = c.nextSibling
+	} else {
+		n.firstChild = c.nextSibling
+	}
+	if c.nextSibling != nil {
+		c.nextSibling.prevSibling = c.prevSibling
+	} else {
+		n.lastChild = c.prevSibling
+	}
+	c.parent, c.prevSibling, c.nextSibling = nil, nil, nil
+}
+
 // addAttribute adds an attribute key with value value.
 func (n *node) addAttribute(key, value string) {
 	n.attributes[key] = value
 }
+
+// isList reports whether n is an ordered or unordered list.
+func (n *node) isList() bool {
+	if n == nil {
+		return false
+	}
+	switch strings.ToLower(n.tagname) {
+	case ORDEREDLIST, UNORDEREDLIST:
+		return true
+	}
+	return false
+}
+
+// isMarkupSection reports whether n is a markup section of the document.
+func (n *node) isMarkupSection() bool {
+	if n.parent == nil || n.parent.tagname != rootTag {
+		return false
+	}
+	switch strings.ToLower(n.tagname) {
+	case PARAGRAPH, H1, H2, H3, H4, H5, H6, BLOCKQUOTE, ASIDE:
+		return true
+	}
+	return false
+}
+
+// listDepth returns the number of lists containing n.
+func (n *node) listDepth() int {
+	depth := 0
+	for p := n.parent; p != nil; p = p.parent {
+		if p.isList() {
+			depth++
+		}
+	}
+	return depth
+}
+
+// inHeading reports whether n is part of a heading.
+func (n *node) inHeading() bool {
+	for p := n.parent; p != nil; p = p.parent {
+		if headingLevel(strings.ToLower(p.tagname)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// endsBlock reports whether nothing but nested lists follows n in its block.
+func (n *node) endsBlock() bool {
+	for c := n; c.parent != nil; c = c.parent {
+		for s := c.nextSibling; s != nil; s = s.nextSibling {
+			if !s.isList() {
+				return false
+			}
+		}
+		if !isInlineMarkup(c.parent.tagname) {
+			break
+		}
+	}
+	return true
+}
+
+// startsLine reports whether n starts a line of its block, being first in it
+// or following a line break.
+func (n *node) startsLine() bool {
+	if n.prevSibling != nil {
+		return strings.ToLower(n.prevSibling.tagname) == BREAK
+	}
+	return n.parent != nil && (n.parent.isMarkupSection() ||
+		strings.ToLower(n.parent.tagname) == LISTITEM)
+}
+
+// lineBreak returns br for the line break n, nothing when it ends its block
+// where it has no effect, or a space in headings, which are a single line.
+func (n *node) lineBreak(br string) string {
+	switch {
+	case n.endsBlock():
+		return ""
+	case n.inHeading():
+		return " "
+	}
+	return br
+}
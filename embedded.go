@@ -0,0 +1,85 @@
+package mobiledoc
+
+import "fmt"
+
+// MarkdownEngine converts the Markdown of markdown cards to HTML
+type MarkdownEngine interface {
+	Convert(markdown string) (string, error)
+}
+
+// MarkdownEngineFunc adapts a function to a MarkdownEngine
+type MarkdownEngineFunc func(markdown string) (string, error)
+
+// Convert calls fn
+func (fn MarkdownEngineFunc) Convert(markdown string) (string, error) {
+	return fn(markdown)
+}
+
+// WithMarkdownEngine creates a new Mobiledoc instance that renders markdown
+// cards to HTML by converting their Markdown with e. Without an engine,
+// markdown cards need a registered card to be rendered to HTML.
+func (md Mobiledoc) WithMarkdownEngine(e MarkdownEngine) Mobiledoc {
+	md.opts.markdownEngine = e
+	return md
+}
+
+// WithSanitizer creates a new Mobiledoc instance that cleans up the HTML of
+// html cards, and of markdown cards converted to HTML, with s, or an
+// AllowlistSanitizer when nil. The links and images of the document itself
+// are then also dropped unless their URLs are safe, as AllowlistSanitizer
+// does. Markdown cards written to Markdown are passed through as they are,
+// raw HTML and links included, so Markdown output still has to be sanitized
+// once converted to HTML.
+func (md Mobiledoc) WithSanitizer(s Sanitizer) Mobiledoc {
+	if s == nil {
+		s = AllowlistSanitizer{}
+	}
+	md.opts.sanitizer = s
+	return md
+}
+
+// sanitize cleans up the HTML s with the sanitizer of o, if any.
+func (o *renderOptions) sanitize(s string) (string, error) {
+	if o.sanitizer == nil {
+		return s, nil
+	}
+	clean, err := o.sanitizer.Sanitize(s)
+	if err != nil {
+		return "", fmt.Errorf("unable to sanitize html: %w", err)
+	}
+	return clean, nil
+}
+
+// embeddedCard returns the renderer of the html and markdown cards, which
+// carry content written by users. HTML is passed through, after being
+// sanitized, and Markdown is passed through to Markdown or converted to
+// HTML.
+func (md *Mobiledoc) embeddedCard(name string) (cardRenderer, bool) {
+	o := &md.opts
+	switch {
+	case name == "html" && (md.format == Markdown || md.format == HTML):
+		return func(c *card, _ Format) (string, error) {
+			m, _ := c.payload.(map[string]interface{})
+			content, _ := payloadString(m, "html")
+			return o.sanitize(content)
+		}, true
+	case (name == "markdown" || name == "card-markdown") && md.format == Markdown:
+		return func(c *card, _ Format) (string, error) {
+			m, _ := c.payload.(map[string]interface{})
+			content, _ := payloadString(m, "markdown")
+			return content, nil
+		}, true
+	case (name == "markdown" || name == "card-markdown") && md.format == HTML &&
+		o.markdownEngine != nil:
+		return func(c *card, _ Format) (string, error) {
+			m, _ := c.payload.(map[string]interface{})
+			content, _ := payloadString(m, "markdown")
+			converted, err := o.markdownEngine.Convert(content)
+			if err != nil {
+				return "", fmt.Errorf("unable to convert markdown: %w", err)
+			}
+			return o.sanitize(converted)
+		}, true
+	}
+	return nil, false
+}
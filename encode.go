@@ -0,0 +1,237 @@
+package mobiledoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// encodeVersion is the Mobiledoc version written by MarshalMobiledoc, the
+// first to support section attributes
+const encodeVersion = "0.3.2"
+
+// encoder builds the tables and sections of a Mobiledoc
+type encoder struct {
+	markups  [][]interface{}
+	atoms    [][]interface{}
+	cards    [][]interface{}
+	sections [][]interface{}
+	// markupIndexes finds markups already in the table by their key
+	markupIndexes map[string]int
+	markers       [][]interface{}
+	pending       []int
+	// lists holds the tags of the lists open at each level, which Parse
+	// resumes when a deeper list came between
+	lists []string
+}
+
+// MarshalMobiledoc encodes the document as Mobiledoc 0.3.2 JSON, which
+// Parse reads back into the same document, apart from markups without any
+// content which are left out
+func (d *Document) MarshalMobiledoc() ([]byte, error) {
+	e := &encoder{markupIndexes: make(map[string]int)}
+	for _, s := range d.Sections {
+		if err := e.section(s); err != nil {
+			return nil, err
+		}
+	}
+	empty := func(table [][]interface{}) [][]interface{} {
+		if table == nil {
+			return [][]interface{}{}
+		}
+		return table
+	}
+	return json.Marshal(struct {
+		Version  string          `json:"version"`
+		Atoms    [][]interface{} `json:"atoms"`
+		Cards    [][]interface{} `json:"cards"`
+		Markups  [][]interface{} `json:"markups"`
+		Sections [][]interface{} `json:"sections"`
+	}{
+		encodeVersion, empty(e.atoms), empty(e.cards), empty(e.markups),
+		empty(e.sections),
+	})
+}
+
+// attributePairs returns attributes as the flat list of pairs used by
+// Mobiledoc, sorted by name.
+func attributePairs(attributes map[string]string) []string {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, attributes[k])
+	}
+	return pairs
+}
+
+func (e *encoder) section(s Section) error {
+	if _, ok := s.(*ListSection); !ok {
+		e.lists = nil
+	}
+	switch s := s.(type) {
+	case *MarkupSection:
+		markers, err := e.markersOf(s.Children)
+		if err != nil {
+			return err
+		}
+		section := []interface{}{sectionMarkup, s.Tag, markers}
+		if len(s.Attributes) > 0 {
+			section = append(section, attributePairs(s.Attributes))
+		}
+		e.sections = append(e.sections, section)
+	case *ListSection:
+		return e.list(s, 0)
+	case *ImageSection:
+		e.sections = append(e.sections, []interface{}{sectionImage, s.Src})
+	case *CardSection:
+		e.cards = append(e.cards, []interface{}{s.Name, s.Payload})
+		e.sections = append(
+			e.sections, []interface{}{sectionCard, len(e.cards) - 1},
+		)
+	default:
+		return fmt.Errorf("unknown section %T", s)
+	}
+	return nil
+}
+
+// list adds list sections for l at the nesting level. Mobiledoc lists are
+// flat, so the items of l are split around its nested lists, which follow
+// the item containing them at the next level. The first section of l is
+// marked as a new list when Parse would otherwise resume an open one.
+func (e *encoder) list(l *ListSection, level int) error {
+	attributes := make(map[string]string)
+	for k, v := range l.Attributes {
+		attributes[k] = v
+	}
+	if level > 0 {
+		attributes[listLevelAttribute] = strconv.Itoa(level)
+	}
+
+	items := [][][]interface{}{}
+	first := true
+	flush := func() {
+		if len(items) == 0 {
+			return
+		}
+		if first && e.resumes(l.Tag, level) {
+			// only the first section starts a new list
+			attributes[listNewAttribute] = "true"
+			defer delete(attributes, listNewAttribute)
+		}
+		first = false
+		section := []interface{}{sectionList, l.Tag, items}
+		if len(attributes) > 0 {
+			section = append(section, attributePairs(attributes))
+		}
+		e.sections = append(e.sections, section)
+		e.lists = append(e.lists[:level], l.Tag)
+		items = [][][]interface{}{}
+	}
+
+	for _, item := range l.Items {
+		markers, err := e.markersOf(item.Children)
+		if err != nil {
+			return err
+		}
+		items = append(items, markers)
+		if len(item.Lists) == 0 {
+			continue
+		}
+		flush()
+		for _, nested := range item.Lists {
+			if err = e.list(nested, level+1); err != nil {
+				return err
+			}
+		}
+	}
+	flush()
+	return nil
+}
+
+// resumes reports whether Parse would add a list section with tag at level
+// to the open list at that level.
+func (e *encoder) resumes(tag string, level int) bool {
+	return level < len(e.lists) && e.lists[level] == tag &&
+		(level > 0 || len(e.lists) > 1)
+}
+
+// markersOf returns the markers for inlines.
+func (e *encoder) markersOf(inlines []Inline) ([][]interface{}, error) {
+	e.markers = [][]interface{}{}
+	e.pending = nil
+	if err := e.inlines(inlines); err != nil {
+		return nil, err
+	}
+	return e.markers, nil
+}
+
+func (e *encoder) inlines(inlines []Inline) error {
+	for _, i := range inlines {
+		switch i := i.(type) {
+		case *TextNode:
+			e.marker(markerMarkup, i.Value)
+		case *AtomNode:
+			e.atoms = append(e.atoms, []interface{}{i.Name, i.Value, i.Payload})
+			e.marker(markerAtom, len(e.atoms)-1)
+		case *BreakNode:
+			e.atoms = append(
+				e.atoms, []interface{}{softReturnAtom, "", map[string]interface{}{}},
+			)
+			e.marker(markerAtom, len(e.atoms)-1)
+		case *Markup:
+			if !hasContent(i.Children) {
+				// a markup is opened and closed by the markers within it
+				continue
+			}
+			e.pending = append(e.pending, e.markup(i))
+			if err := e.inlines(i.Children); err != nil {
+				return err
+			}
+			last := e.markers[len(e.markers)-1]
+			last[2] = last[2].(int) + 1
+		default:
+			return fmt.Errorf("unknown inline %T", i)
+		}
+	}
+	return nil
+}
+
+// hasContent reports whether inlines contain any text or atoms.
+func hasContent(inlines []Inline) bool {
+	for _, i := range inlines {
+		if m, ok := i.(*Markup); !ok || hasContent(m.Children) {
+			return true
+		}
+	}
+	return false
+}
+
+// marker adds a marker opening the pending markups.
+func (e *encoder) marker(markerType int, value interface{}) {
+	open := e.pending
+	if open == nil {
+		open = []int{}
+	}
+	e.markers = append(e.markers, []interface{}{markerType, open, 0, value})
+	e.pending = nil
+}
+
+// markup returns the index of m in the markups table, adding it if needed.
+func (e *encoder) markup(m *Markup) int {
+	key := markupKey(m)
+	if i, ok := e.markupIndexes[key]; ok {
+		return i
+	}
+	markup := []interface{}{m.Tag}
+	if len(m.Attributes) > 0 {
+		markup = append(markup, attributePairs(m.Attributes))
+	}
+	e.markups = append(e.markups, markup)
+	e.markupIndexes[key] = len(e.markups) - 1
+	return len(e.markups) - 1
+}
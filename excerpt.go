@@ -0,0 +1,233 @@
+package mobiledoc
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ExcerptOptions selects how much of a document is kept by Excerpt
+type ExcerptOptions struct {
+	// Words and Characters are the most words and characters other than
+	// whitespace kept, with 0 leaving the count unlimited. Words are counted
+	// as by Statistics.
+	Words, Characters int
+	// Cards keeps cards and image sections, which are dropped by default.
+	// They do not count towards the limits.
+	Cards bool
+	// Ellipsis is appended to the section that is cut short within its text
+	Ellipsis string
+}
+
+// Excerpt returns a Transform that cuts the document short after the words
+// or characters allowed by opts. The sections after the limit is reached
+// are removed, and the section reaching it is cut at the end of a word or
+// character, keeping the markups around the remaining text so that any
+// format renders a complete fragment.
+func Excerpt(opts ExcerptOptions) Transform {
+	return func(d *Document) error {
+		t := newTruncator(opts)
+		var sections []Section
+		for _, s := range d.Sections {
+			if t.exhausted() {
+				break
+			}
+			switch s := s.(type) {
+			case *MarkupSection:
+				t.inWord = false
+				s.Children = t.inlines(s.Children)
+				if t.done {
+					s.Children = trimTrailingSpace(s.Children)
+				}
+				if len(s.Children) == 0 {
+					continue
+				}
+				if t.done && opts.Ellipsis != "" {
+					s.Children = append(s.Children, &TextNode{Value: opts.Ellipsis})
+				}
+			case *ListSection:
+				if !t.list(s) {
+					continue
+				}
+				if t.done && opts.Ellipsis != "" {
+					item := lastItem(s)
+					item.Children = append(item.Children, &TextNode{Value: opts.Ellipsis})
+				}
+			default:
+				if !opts.Cards {
+					continue
+				}
+			}
+			sections = append(sections, s)
+		}
+		d.Sections = sections
+		return nil
+	}
+}
+
+// truncator keeps text until the words or characters left run out
+type truncator struct {
+	// words and chars are the words and characters left, when limited
+	words, chars           int
+	limitWords, limitChars bool
+	// inWord is set within a word, which may continue in the next text
+	inWord bool
+	// done is set once text has been cut short
+	done bool
+}
+
+func newTruncator(opts ExcerptOptions) *truncator {
+	return &truncator{
+		words:      opts.Words,
+		chars:      opts.Characters,
+		limitWords: opts.Words > 0,
+		limitChars: opts.Characters > 0,
+	}
+}
+
+// exhausted reports whether no more text can be kept.
+func (t *truncator) exhausted() bool {
+	return t.done || (t.limitWords && t.words == 0) ||
+		(t.limitChars && t.chars == 0)
+}
+
+// text returns the part of s that is kept, ending before the first word or
+// character beyond the limits.
+func (t *truncator) text(s string) string {
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			t.inWord = false
+			continue
+		}
+		startsWord := isIdeograph(r) ||
+			(!t.inWord && (unicode.IsLetter(r) || unicode.IsNumber(r)))
+		if (t.limitWords && startsWord && t.words == 0) ||
+			(t.limitChars && t.chars == 0) {
+			t.done = true
+			return s[:i]
+		}
+		if startsWord {
+			t.words--
+		}
+		t.chars--
+		t.inWord = !isIdeograph(r) && (startsWord || t.inWord)
+	}
+	return s
+}
+
+// inlines returns the inlines that are kept, cutting the text short.
+func (t *truncator) inlines(inlines []Inline) []Inline {
+	var kept []Inline
+	for _, i := range inlines {
+		if t.done {
+			break
+		}
+		switch i := i.(type) {
+		case *TextNode:
+			i.Value = t.text(i.Value)
+			if i.Value == "" {
+				continue
+			}
+		case *Markup:
+			i.Children = t.inlines(i.Children)
+			if len(i.Children) == 0 {
+				continue
+			}
+		case *BreakNode:
+			t.inWord = false
+		}
+		kept = append(kept, i)
+	}
+	return kept
+}
+
+// list cuts the items of l short, reporting whether any are kept.
+func (t *truncator) list(l *ListSection) bool {
+	var items []*ListItem
+	for _, item := range l.Items {
+		if t.exhausted() {
+			break
+		}
+		t.inWord = false
+		item.Children = t.inlines(item.Children)
+		if t.done {
+			item.Children = trimTrailingSpace(item.Children)
+		}
+		var lists []*ListSection
+		for _, nested := range item.Lists {
+			if t.exhausted() {
+				break
+			}
+			if t.list(nested) {
+				lists = append(lists, nested)
+			}
+		}
+		item.Lists = lists
+		if len(item.Children) == 0 && len(item.Lists) == 0 {
+			continue
+		}
+		items = append(items, item)
+	}
+	l.Items = items
+	return len(items) > 0
+}
+
+// lastItem returns the last item of l, including the items of nested lists.
+func lastItem(l *ListSection) *ListItem {
+	item := l.Items[len(l.Items)-1]
+	if len(item.Lists) > 0 {
+		return lastItem(item.Lists[len(item.Lists)-1])
+	}
+	return item
+}
+
+// trimTrailingSpace removes the whitespace and line breaks at the end of
+// inlines.
+func trimTrailingSpace(inlines []Inline) []Inline {
+	if len(inlines) == 0 {
+		return inlines
+	}
+	switch i := inlines[len(inlines)-1].(type) {
+	case *TextNode:
+		i.Value = strings.TrimRightFunc(i.Value, unicode.IsSpace)
+		if i.Value == "" {
+			return trimTrailingSpace(inlines[:len(inlines)-1])
+		}
+	case *Markup:
+		i.Children = trimTrailingSpace(i.Children)
+		if len(i.Children) == 0 {
+			return trimTrailingSpace(inlines[:len(inlines)-1])
+		}
+	case *BreakNode:
+		return trimTrailingSpace(inlines[:len(inlines)-1])
+	}
+	return inlines
+}
+
+// PlainText returns the text of the document, with a blank line between
+// sections and each list item on a line of its own. Cards, images and atoms
+// have no text.
+func PlainText(d *Document) string {
+	var sections []string
+	for _, s := range d.Sections {
+		switch s := s.(type) {
+		case *MarkupSection:
+			sections = append(sections, inlineText(s.Children))
+		case *ListSection:
+			sections = append(sections, strings.Join(listText(s), "\n"))
+		}
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// listText returns the text of the items of l and of the lists nested in
+// them.
+func listText(l *ListSection) []string {
+	var lines []string
+	for _, item := range l.Items {
+		lines = append(lines, inlineText(item.Children))
+		for _, nested := range item.Lists {
+			lines = append(lines, listText(nested)...)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,160 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gemtextCards are the cards rendered natively to Gemtext, unless replaced
+// by a registered card of the same name
+var gemtextCards = map[string]Card{
+	"code": gemtextCodeCard,
+}
+
+// gemtextLineTypes are the prefixes of the lines that are not text
+var gemtextLineTypes = []string{"=>", "#", "* ", ">", "```"}
+
+// gemtextGuard indents the lines of s starting with one of the prefixes, so
+// that they are not read as a line of another type.
+func gemtextGuard(s string, prefixes ...string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		for _, p := range prefixes {
+			if strings.HasPrefix(line, p) {
+				lines[i] = " " + line
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func gemtextCodeCard(payload interface{}) string {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, _ := payloadString(m, "code")
+
+	// the alt text of a preformatted block describes its content
+	alt, ok := payloadString(m, "caption")
+	if !ok {
+		alt, _ = payloadString(m, "language")
+	}
+	alt = strings.ReplaceAll(alt, "\n", " ")
+	return fmt.Sprintf("```%s\n%s\n```", alt, gemtextGuard(code, "```"))
+}
+
+// links returns the links contained in n, in document order.
+func (n *node) links() []*node {
+	var links []*node
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if strings.ToLower(c.tagname) == ANCHOR {
+			links = append(links, c)
+			continue
+		}
+		links = append(links, c.links()...)
+	}
+	return links
+}
+
+// renderGemtextLinks writes a link line for each link in n. Gemtext has no
+// inline links, so they follow the block containing them.
+func (n *node) renderGemtextLinks(w io.Writer) error {
+	for _, l := range n.links() {
+		_, err := fmt.Fprintf(w, "=> %s %s\n", l.attributes["href"], l.text())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gemtextText returns the text of n without its nested lists, on a single
+// line.
+func (n *node) gemtextText() string {
+	var b strings.Builder
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if !c.isList() {
+			b.WriteString(c.text())
+		}
+	}
+	return strings.ReplaceAll(b.String(), "\n", " ")
+}
+
+// renderGemtextList writes the items of the list n and of the lists nested
+// in it, as Gemtext lists can not nest.
+func (n *node) renderGemtextList(w io.Writer) error {
+	for li := n.firstChild; li != nil; li = li.nextSibling {
+		marker := li.listMarker()
+		_, err := fmt.Fprintf(w, "%s%s\n", marker, li.gemtextText())
+		if err != nil {
+			return err
+		}
+		if nested := li.lastChild; nested.isList() {
+			if err = nested.renderGemtextList(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (n *node) renderGemtextImage(w io.Writer) error {
+	description, ok := n.attributes["caption"]
+	if !ok {
+		description = n.attributes["alt"]
+	}
+	_, err := fmt.Fprintf(
+		w, "%s\n\n",
+		strings.TrimSpace("=> "+n.attributes["src"]+" "+description),
+	)
+	return err
+}
+
+// renderGemtextSection writes a section of the document followed by the
+// links it contains.
+func (n *node) renderGemtextSection(w io.Writer) error {
+	var err error
+	tag := strings.ToLower(n.tagname)
+	switch {
+	case n.tagname == cardTag:
+		_, err = fmt.Fprintf(w, "%s\n\n", strings.TrimRight(n.text(), "\n"))
+		return err
+	case tag == IMAGE:
+		return n.renderGemtextImage(w)
+	case n.isList():
+		err = n.renderGemtextList(w)
+	case tag == H1:
+		_, err = fmt.Fprintf(w, "# %s\n", n.text())
+	case tag == H2:
+		_, err = fmt.Fprintf(w, "## %s\n", n.text())
+	case tag == H3, tag == H4, tag == H5, tag == H6:
+		_, err = fmt.Fprintf(w, "### %s\n", n.text())
+	case tag == BLOCKQUOTE:
+		// every line of a quote is quoted
+		text := strings.ReplaceAll(n.text(), "\n", "\n> ")
+		_, err = fmt.Fprintf(w, "> %s\n", text)
+	default:
+		_, err = fmt.Fprintf(w, "%s\n", gemtextGuard(n.text(), gemtextLineTypes...))
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = n.renderGemtextLinks(w); err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, "\n")
+	return err
+}
+
+func (n *node) renderGemtext(w io.Writer) error {
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if err := c.renderGemtextSection(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package mobiledoc
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Highlighter writes code in a language as HTML, escaping it and marking up
+// its tokens
+type Highlighter interface {
+	Highlight(code, language string) (string, error)
+}
+
+// HighlighterFunc adapts a function to a Highlighter
+type HighlighterFunc func(code, language string) (string, error)
+
+// Highlight calls fn
+func (fn HighlighterFunc) Highlight(code, language string) (string, error) {
+	return fn(code, language)
+}
+
+// ClassHighlighter is the default Highlighter. It wraps the keywords,
+// strings, numbers and comments of common languages in spans with the
+// classes keyword, string, number and comment, after the prefix. Code in
+// other languages is only escaped.
+type ClassHighlighter struct {
+	// Prefix is prepended to the class names, "hl-" when empty
+	Prefix string
+}
+
+// syntax describes the tokens of a language
+type syntax struct {
+	lineComments []string
+	blockComment [2]string
+	// quotes are the characters strings are quoted with
+	quotes   string
+	keywords []string
+	// foldCase is set when keywords are not case sensitive
+	foldCase bool
+}
+
+var (
+	cSyntax = syntax{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		keywords: []string{
+			"auto", "break", "case", "char", "const", "continue", "default",
+			"do", "double", "else", "enum", "extern", "float", "for", "goto",
+			"if", "int", "long", "return", "short", "signed", "sizeof",
+			"static", "struct", "switch", "typedef", "union", "unsigned",
+			"void", "volatile", "while",
+		},
+	}
+	goSyntax = syntax{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		keywords: []string{
+			"break", "case", "chan", "const", "continue", "default", "defer",
+			"else", "fallthrough", "false", "for", "func", "go", "goto", "if",
+			"import", "interface", "map", "nil", "package", "range", "return",
+			"select", "struct", "switch", "true", "type", "var",
+		},
+	}
+	javaScriptSyntax = syntax{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+		keywords: []string{
+			"async", "await", "break", "case", "catch", "class", "const",
+			"continue", "default", "delete", "do", "else", "export", "extends",
+			"false", "finally", "for", "function", "if", "import", "in",
+			"instanceof", "let", "new", "null", "return", "super", "switch",
+			"this", "throw", "true", "try", "typeof", "undefined", "var",
+			"void", "while", "yield",
+		},
+	}
+	pythonSyntax = syntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords: []string{
+			"and", "as", "assert", "async", "await", "break", "class",
+			"continue", "def", "del", "elif", "else", "except", "False",
+			"finally", "for", "from", "global", "if", "import", "in", "is",
+			"lambda", "None", "nonlocal", "not", "or", "pass", "raise",
+			"return", "True", "try", "while", "with", "yield",
+		},
+	}
+	shellSyntax = syntax{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords: []string{
+			"case", "do", "done", "elif", "else", "esac", "export", "fi", "for",
+			"function", "if", "in", "local", "return", "then", "until",
+			"while",
+		},
+	}
+	sqlSyntax = syntax{
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+		keywords: []string{
+			"and", "as", "by", "create", "delete", "from", "group", "having",
+			"insert", "into", "join", "limit", "not", "null", "on", "or",
+			"order", "select", "set", "table", "update", "values", "where",
+		},
+		foldCase: true,
+	}
+)
+
+// syntaxes maps language names and aliases to their syntax
+var syntaxes = map[string]*syntax{
+	"c":          &cSyntax,
+	"go":         &goSyntax,
+	"golang":     &goSyntax,
+	"javascript": &javaScriptSyntax,
+	"js":         &javaScriptSyntax,
+	"typescript": &javaScriptSyntax,
+	"ts":         &javaScriptSyntax,
+	"python":     &pythonSyntax,
+	"py":         &pythonSyntax,
+	"bash":       &shellSyntax,
+	"sh":         &shellSyntax,
+	"shell":      &shellSyntax,
+	"sql":        &sqlSyntax,
+}
+
+// isKeyword reports whether word is a keyword of s.
+func (s *syntax) isKeyword(word string) bool {
+	for _, k := range s.keywords {
+		if k == word || (s.foldCase && strings.EqualFold(k, word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWordRune reports whether r can be part of an identifier or number.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Highlight writes code as HTML with its tokens in spans
+func (h ClassHighlighter) Highlight(code, language string) (string, error) {
+	s, ok := syntaxes[strings.ToLower(language)]
+	if !ok {
+		return html.EscapeString(code), nil
+	}
+	prefix := h.Prefix
+	if prefix == "" {
+		prefix = "hl-"
+	}
+
+	var b strings.Builder
+	span := func(class, token string) {
+		b.WriteString(`<span class="` + html.EscapeString(prefix+class) + `">`)
+		b.WriteString(html.EscapeString(token))
+		b.WriteString("</span>")
+	}
+
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		if n := s.commentLength(rest); n > 0 {
+			span("comment", rest[:n])
+			i += n
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case strings.ContainsRune(s.quotes, r):
+			n := stringLength(rest, r)
+			span("string", rest[:n])
+			i += n
+		case isWordRune(r):
+			n := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+			if n < 0 {
+				n = len(rest)
+			}
+			word := rest[:n]
+			switch {
+			case unicode.IsDigit(r):
+				span("number", word)
+			case s.isKeyword(word):
+				span("keyword", word)
+			default:
+				b.WriteString(html.EscapeString(word))
+			}
+			i += n
+		default:
+			b.WriteString(html.EscapeString(rest[:size]))
+			i += size
+		}
+	}
+	return b.String(), nil
+}
+
+// commentLength returns the length of the comment code starts with, or 0.
+// An unterminated block comment runs to the end of the code.
+func (s *syntax) commentLength(code string) int {
+	for _, start := range s.lineComments {
+		if strings.HasPrefix(code, start) {
+			if n := strings.IndexByte(code, '\n'); n >= 0 {
+				return n
+			}
+			return len(code)
+		}
+	}
+	start, end := s.blockComment[0], s.blockComment[1]
+	if start != "" && strings.HasPrefix(code, start) {
+		if n := strings.Index(code[len(start):], end); n >= 0 {
+			return len(start) + n + len(end)
+		}
+		return len(code)
+	}
+	return 0
+}
+
+// stringLength returns the length of the string quoted by quote that code
+// starts with. Backslashes escape the next character, except in strings
+// quoted by backticks, which are the only ones that may span lines.
+func stringLength(code string, quote rune) int {
+	for i := 1; i < len(code); i++ {
+		switch c := rune(code[i]); {
+		case c == '\\' && quote != '`':
+			i++
+		case c == quote:
+			return i + 1
+		case c == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(code)
+}
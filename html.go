@@ -0,0 +1,265 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// htmlTagName returns the lower case name of the element used for n.
+//
+// Section tags that are not known are rendered as paragraphs so that
+// arbitrary elements can not be introduced by a document.
+func (n *node) htmlTagName() string {
+	tag := strings.ToLower(n.tagname)
+	switch tag {
+	case BOLD, CODE, STRONG, ITALIC, EMPHASIS, ANCHOR, UNDERLINE,
+		SUBSCRIPT, SUPERSCRIPT, STRIKETHROUGH, IMAGE, LISTITEM,
+		ORDEREDLIST, UNORDEREDLIST, H1, H2, H3, H4, H5, H6,
+		BLOCKQUOTE, ASIDE, PARAGRAPH:
+		return tag
+	}
+	return PARAGRAPH
+}
+
+// isHTMLBlock reports whether n is rendered on a line of its own.
+func (n *node) isHTMLBlock() bool {
+	if n.parent != nil && n.parent.tagname == rootTag {
+		return true
+	}
+	switch strings.ToLower(n.tagname) {
+	case LISTITEM, ORDEREDLIST, UNORDEREDLIST:
+		return true
+	}
+	return false
+}
+
+// markupAttributes are the attributes kept for inline markups, by tag, so
+// that a document can not add event handlers or styles
+var markupAttributes = map[string][]string{
+	ANCHOR: {"href", "title", "rel", "target"},
+}
+
+// textAlignments are the text alignments applied as a style
+var textAlignments = map[string]bool{
+	"left": true, "center": true, "right": true, "justify": true,
+}
+
+// validAttributeName reports whether k can be written as an attribute name
+// as it is, being a letter followed by letters, digits and -_.:
+func validAttributeName(k string) bool {
+	if k == "" || !isASCIILetter(k[0]) {
+		return false
+	}
+	for i := 1; i < len(k); i++ {
+		c := k[i]
+		if !isASCIILetter(c) && (c < '0' || c > '9') &&
+			!strings.ContainsRune("-_.:", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// htmlAttributes returns the attributes written to the element for n.
+//
+// Only data attributes with valid names are kept for sections, with a known
+// text alignment also applied as a style. Inline markups keep the attributes
+// allowed for their tag, with links dropped unless their scheme is safe.
+func (n *node) htmlAttributes() map[string]string {
+	switch {
+	case strings.ToLower(n.tagname) == LISTITEM:
+		// list positions are implied by the element order
+		return nil
+	case strings.ToLower(n.tagname) == IMAGE:
+		attributes := make(map[string]string)
+		for _, k := range []string{"src", "alt", "title", "width", "height"} {
+			if v, ok := n.attributes[k]; ok {
+				attributes[k] = v
+			}
+		}
+		return attributes
+	case n.isMarkupSection():
+		attributes := make(map[string]string)
+		for k, v := range n.attributes {
+			if strings.HasPrefix(k, "data-") && validAttributeName(k) {
+				attributes[k] = v
+			}
+		}
+		if align := attributes[textAlignAttribute]; textAlignments[align] {
+			attributes["style"] = "text-align: " + align
+		}
+		return attributes
+	}
+
+	attributes := make(map[string]string)
+	for _, k := range markupAttributes[strings.ToLower(n.tagname)] {
+		v, ok := n.attributes[k]
+		if !ok || (urlAttributes[k] && !safeURL(v)) {
+			continue
+		}
+		attributes[k] = v
+	}
+	return attributes
+}
+
+func (n *node) renderHTMLAttributes(w io.Writer) error {
+	attributes := n.htmlAttributes()
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !validAttributeName(k) {
+			continue
+		}
+		_, err := fmt.Fprintf(
+			w, ` %s="%s"`,
+			html.EscapeString(k), html.EscapeString(attributes[k]),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *node) renderHTMLStart(w io.Writer) error {
+	var err error
+	if n.isList() && n.parent != nil &&
+		strings.ToLower(n.parent.tagname) == LISTITEM {
+		// nested lists start on their own line
+		if _, err = fmt.Fprint(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	if _, err = fmt.Fprintf(w, "<%s", n.htmlTagName()); err != nil {
+		return err
+	}
+	if n.id != "" {
+		if _, err = fmt.Fprintf(w, ` id="%s"`, html.EscapeString(n.id)); err != nil {
+			return err
+		}
+	}
+	if err = n.renderHTMLAttributes(w); err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, ">")
+	if err == nil && n.isList() {
+		_, err = fmt.Fprint(w, "\n")
+	}
+	return err
+}
+
+func (n *node) renderHTMLEnd(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "</%s>", n.htmlTagName())
+	if err != nil {
+		return err
+	}
+	if n.isHTMLBlock() {
+		_, err = fmt.Fprint(w, "\n")
+	}
+	return err
+}
+
+// renderHTMLImage writes the image n, inside a figure when it has a caption
+// or a card width.
+func (n *node) renderHTMLImage(w io.Writer) error {
+	var err error
+	caption, hasCaption := n.attributes["caption"]
+	cardWidth, hasCardWidth := n.attributes["cardWidth"]
+	figure := hasCaption || hasCardWidth
+
+	if figure {
+		if _, err = fmt.Fprint(w, "<figure"); err != nil {
+			return err
+		}
+		if hasCardWidth {
+			_, err = fmt.Fprintf(
+				w, ` class="kg-width-%s"`, html.EscapeString(cardWidth),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err = fmt.Fprint(w, ">"); err != nil {
+			return err
+		}
+	}
+
+	if _, err = fmt.Fprint(w, "<img"); err != nil {
+		return err
+	}
+	if err = n.renderHTMLAttributes(w); err != nil {
+		return err
+	}
+	if _, err = fmt.Fprint(w, ">"); err != nil {
+		return err
+	}
+
+	if hasCaption {
+		_, err = fmt.Fprintf(
+			w, "<figcaption>%s</figcaption>", html.EscapeString(caption),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if figure {
+		_, err = fmt.Fprint(w, "</figure>")
+	}
+	return err
+}
+
+func (n *node) renderHTMLContent(w io.Writer) error {
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if err := c.renderHTML(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *node) renderHTML(w io.Writer) error {
+	var err error
+	switch n.tagname {
+	case TEXT:
+		_, err = fmt.Fprint(w, html.EscapeString(n.value))
+		return err
+	case rawTag:
+		_, err = fmt.Fprint(w, n.value)
+		return err
+	case rootTag:
+		return n.renderHTMLContent(w)
+	case BREAK:
+		_, err = fmt.Fprint(w, "<br>")
+		return err
+	case IMAGE:
+		if err = n.renderHTMLImage(w); err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, "\n")
+		return err
+	case cardTag:
+		if err = n.renderHTMLContent(w); err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, "\n")
+		return err
+	}
+
+	if err = n.renderHTMLStart(w); err != nil {
+		return err
+	}
+
+	if err = n.renderHTMLContent(w); err != nil {
+		return err
+	}
+
+	return n.renderHTMLEnd(w)
+}
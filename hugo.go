@@ -0,0 +1,238 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// HugoShortcodes names the shortcodes written when rendering Markdown for
+// Hugo. Empty names fall back to Hugo's built-in shortcodes, or for content
+// Hugo has no shortcode for, to the conventional name of a shortcode the
+// site is expected to provide. Templates replace the shortcodes altogether.
+type HugoShortcodes struct {
+	Figure    string
+	Gallery   string
+	YouTube   string
+	Vimeo     string
+	Tweet     string
+	Gist      string
+	Highlight string
+	Callout   string
+
+	// Templates render a kind of content with a user-provided template
+	// rather than a shortcode. The kinds are "image", executed with the
+	// image attributes as the payload, and the "gallery", "embed", "code"
+	// and "callout" cards, executed with their payload.
+	Templates map[string]Template
+}
+
+// withDefaults returns a copy of s with the empty names replaced by the
+// default shortcodes
+func (s HugoShortcodes) withDefaults() HugoShortcodes {
+	defaults := []struct {
+		name     *string
+		fallback string
+	}{
+		{&s.Figure, "figure"},
+		{&s.Gallery, "gallery"},
+		{&s.YouTube, "youtube"},
+		{&s.Vimeo, "vimeo"},
+		{&s.Tweet, "tweet"},
+		{&s.Gist, "gist"},
+		{&s.Highlight, "highlight"},
+		{&s.Callout, "callout"},
+	}
+	for _, d := range defaults {
+		if *d.name == "" {
+			*d.name = d.fallback
+		}
+	}
+	return s
+}
+
+// shortcodeArg quotes a shortcode argument value, escaping its double quotes
+// with backslashes, which Hugo unescapes in quoted arguments.
+func shortcodeArg(v string) string {
+	return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+}
+
+// shortcode formats an opening shortcode tag. The arguments are name and
+// value pairs, with an empty name for a positional argument; pairs with an
+// empty value are left out.
+func shortcode(name string, args ...string) string {
+	var b strings.Builder
+	b.WriteString("{{< ")
+	b.WriteString(name)
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i+1] == "" {
+			continue
+		}
+		b.WriteString(" ")
+		if args[i] != "" {
+			b.WriteString(args[i])
+			b.WriteString("=")
+		}
+		b.WriteString(shortcodeArg(args[i+1]))
+	}
+	b.WriteString(" >}}")
+	return b.String()
+}
+
+// closeShortcode formats the closing tag of a paired shortcode.
+func closeShortcode(name string) string {
+	return "{{< /" + name + " >}}"
+}
+
+// image renders the image attributes with the image template, or as a figure
+// shortcode.
+func (s HugoShortcodes) image(attributes map[string]string) (string, error) {
+	t, ok := s.Templates["image"]
+	if !ok {
+		return s.figure(attributes), nil
+	}
+	payload := make(map[string]interface{}, len(attributes))
+	for k, v := range attributes {
+		payload[k] = v
+	}
+	return templateCard(t)(&card{name: "image", payload: payload}, Markdown)
+}
+
+// figure formats the figure shortcode for the image attributes.
+func (s HugoShortcodes) figure(attributes map[string]string) string {
+	return shortcode(
+		s.Figure,
+		"src", attributes["src"],
+		"alt", attributes["alt"],
+		"title", attributes["title"],
+		"caption", attributes["caption"],
+		"width", attributes["width"],
+		"height", attributes["height"],
+	)
+}
+
+// card returns the renderer of the named Ghost card, with its template or
+// with shortcodes, sanitizing HTML with the options o.
+func (s HugoShortcodes) card(name string, o *renderOptions) (cardRenderer, bool) {
+	var renderer cardRenderer
+	switch name {
+	case "gallery":
+		renderer = Card(s.gallery).renderer()
+	case "embed":
+		renderer = func(c *card, _ Format) (string, error) {
+			return s.embed(c.payload, o)
+		}
+	case "code":
+		renderer = Card(s.code).renderer()
+	case "callout":
+		renderer = func(c *card, _ Format) (string, error) {
+			return s.callout(c.payload, o)
+		}
+	default:
+		return nil, false
+	}
+	if t, ok := s.Templates[name]; ok {
+		return templateCard(t), true
+	}
+	return renderer, true
+}
+
+func (s HugoShortcodes) gallery(payload interface{}) string {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	images, ok := m["images"].([]interface{})
+	if !ok {
+		return ""
+	}
+
+	caption, _ := payloadString(m, "caption")
+	lines := []string{shortcode(s.Gallery, "caption", caption)}
+	for _, image := range images {
+		im, ok := image.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		attributes := make(map[string]string)
+		for _, k := range append([]string{"src"}, imageAttributes...) {
+			if v, ok := payloadString(im, k); ok {
+				attributes[k] = v
+			}
+		}
+		lines = append(lines, s.figure(attributes))
+	}
+	lines = append(lines, closeShortcode(s.Gallery))
+	return strings.Join(lines, "\n")
+}
+
+// embed writes a shortcode for the embedded content from known sites, or
+// else its HTML, sanitized with the options o, or a link to it.
+func (s HugoShortcodes) embed(payload interface{}, o *renderOptions) (string, error) {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+	raw, _ := payloadString(m, "url")
+	u, err := url.Parse(raw)
+	if err != nil || raw == "" {
+		html, _ := payloadString(m, "html")
+		return o.sanitize(html)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case host == "youtube.com" && u.Query().Get("v") != "":
+		return shortcode(s.YouTube, "", u.Query().Get("v")), nil
+	case host == "youtube.com" && len(parts) == 2 && parts[0] == "embed",
+		host == "youtu.be" && len(parts) == 1 && parts[0] != "":
+		return shortcode(s.YouTube, "", parts[len(parts)-1]), nil
+	case host == "vimeo.com" && len(parts) > 0 && parts[len(parts)-1] != "":
+		return shortcode(s.Vimeo, "", parts[len(parts)-1]), nil
+	case (host == "twitter.com" || host == "x.com") &&
+		len(parts) >= 3 && parts[1] == "status":
+		return shortcode(s.Tweet, "user", parts[0], "id", parts[2]), nil
+	case host == "gist.github.com" && len(parts) == 2:
+		return shortcode(s.Gist, "", parts[0], "", parts[1]), nil
+	}
+
+	if html, ok := payloadString(m, "html"); ok {
+		return o.sanitize(html)
+	}
+	return fmt.Sprintf("<%s>", raw), nil
+}
+
+func (s HugoShortcodes) code(payload interface{}) string {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, _ := payloadString(m, "code")
+	language, ok := payloadString(m, "language")
+	if !ok {
+		language = "text"
+	}
+	return shortcode(s.Highlight, "", language) + "\n" +
+		code + "\n" +
+		closeShortcode(s.Highlight)
+}
+
+// callout writes the callout shortcode around the HTML of the callout,
+// sanitized with the options o.
+func (s HugoShortcodes) callout(payload interface{}, o *renderOptions) (string, error) {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+	emoji, _ := payloadString(m, "calloutEmoji")
+	color, _ := payloadString(m, "backgroundColor")
+	text, _ := payloadString(m, "calloutText")
+	text, err := o.sanitize(text)
+	if err != nil {
+		return "", err
+	}
+	return shortcode(s.Callout, "emoji", emoji, "color", color) + "\n" +
+		text + "\n" +
+		closeShortcode(s.Callout), nil
+}
@@ -0,0 +1,279 @@
+package mobiledoc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// latexCommands maps tags to the command their content is an argument of.
+// The output is a document body, which needs the hyperref, graphicx and
+// ulem packages.
+var latexCommands = map[string]string{
+	BOLD:          `\textbf`,
+	STRONG:        `\textbf`,
+	ITALIC:        `\emph`,
+	EMPHASIS:      `\emph`,
+	CODE:          `\texttt`,
+	UNDERLINE:     `\underline`,
+	STRIKETHROUGH: `\sout`,
+	SUBSCRIPT:     `\textsubscript`,
+	SUPERSCRIPT:   `\textsuperscript`,
+	H1:            `\section`,
+	H2:            `\subsection`,
+	H3:            `\subsubsection`,
+	H4:            `\paragraph`,
+	H5:            `\subparagraph`,
+	H6:            `\subparagraph`,
+}
+
+// latexAlignments maps text alignments to the environment applying them
+var latexAlignments = map[string]string{
+	"left":   "flushleft",
+	"center": "center",
+	"right":  "flushright",
+}
+
+// latexCards are the cards rendered natively to LaTeX, unless replaced by a
+// registered card of the same name
+var latexCards = map[string]Card{
+	"code": latexCodeCard,
+}
+
+// latexEscaper escapes the characters that are special to LaTeX
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"&", `\&`,
+	"%", `\%`,
+	"$", `\$`,
+	"#", `\#`,
+	"_", `\_`,
+	"{", `\{`,
+	"}", `\}`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+// latexURLEscaper escapes the characters of a URL that hyperref does not
+// accept as they are
+var latexURLEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"%", `\%`,
+	"#", `\#`,
+	"{", `\{`,
+	"}", `\}`,
+)
+
+// latexListingsLanguages maps code languages to those predefined by the
+// listings package, as other languages fail to load
+var latexListingsLanguages = map[string]string{
+	"bash":   "bash",
+	"sh":     "bash",
+	"shell":  "bash",
+	"c":      "C",
+	"cpp":    "C++",
+	"c++":    "C++",
+	"html":   "HTML",
+	"java":   "Java",
+	"perl":   "Perl",
+	"php":    "PHP",
+	"python": "Python",
+	"py":     "Python",
+	"ruby":   "Ruby",
+	"sql":    "SQL",
+	"xml":    "XML",
+}
+
+// latexListingEnd ends a listing, wherever it is in the code
+const latexListingEnd = `\end{lstlisting}`
+
+// latexCodeCard writes code as a listing, which needs the listings package.
+// The end of the listing is written in escaped LaTeX when it is part of the
+// code, so that it can not end the listing early.
+func latexCodeCard(payload interface{}) string {
+	code, language, caption := codePayload(payload)
+
+	var options []string
+	if l, ok := latexListingsLanguages[strings.ToLower(language)]; ok {
+		options = append(options, "language="+l)
+	}
+	if caption != "" {
+		options = append(options, "caption={"+latexEscaper.Replace(caption)+"}")
+	}
+	if strings.Contains(code, latexListingEnd) {
+		escape := " "
+		for _, c := range []string{"|", "!", "@", "?"} {
+			if !strings.Contains(code, c) {
+				escape = c
+				break
+			}
+		}
+		if escape == " " {
+			// without an escape character, a space keeps the end apart
+			code = strings.ReplaceAll(code, latexListingEnd, `\end {lstlisting}`)
+		} else {
+			options = append(options, "escapechar="+escape)
+			code = strings.ReplaceAll(
+				code, latexListingEnd,
+				escape+latexEscaper.Replace(latexListingEnd)+escape,
+			)
+		}
+	}
+
+	begin := `\begin{lstlisting}`
+	if len(options) > 0 {
+		begin += "[" + strings.Join(options, ", ") + "]"
+	}
+	return fmt.Sprintf("%s\n%s\n%s", begin, code, latexListingEnd)
+}
+
+func (n *node) renderLaTeXImage(w io.Writer) error {
+	src := latexURLEscaper.Replace(n.attributes["src"])
+	caption, ok := n.attributes["caption"]
+	if !ok {
+		_, err := fmt.Fprintf(w, "\\includegraphics{%s}\n\n", src)
+		return err
+	}
+
+	_, err := fmt.Fprintf(
+		w,
+		"\\begin{figure}[h]\n\\centering\n\\includegraphics{%s}\n"+
+			"\\caption{%s}\n\\end{figure}\n\n",
+		src, latexEscaper.Replace(caption),
+	)
+	return err
+}
+
+func (n *node) renderLaTeXStart(w io.Writer) error {
+	var err error
+	if env, ok := latexAlignments[n.attributes[textAlignAttribute]]; ok &&
+		n.isMarkupSection() {
+		if _, err = fmt.Fprintf(w, "\\begin{%s}\n", env); err != nil {
+			return err
+		}
+	}
+
+	tag := strings.ToLower(n.tagname)
+	if command, ok := latexCommands[tag]; ok {
+		_, err = fmt.Fprint(w, command, "{")
+		return err
+	}
+
+	switch tag {
+	case ANCHOR:
+		_, err = fmt.Fprintf(
+			w, "\\href{%s}{", latexURLEscaper.Replace(n.attributes["href"]),
+		)
+	case UNORDEREDLIST:
+		_, err = fmt.Fprint(w, "\\begin{itemize}\n")
+	case ORDEREDLIST:
+		_, err = fmt.Fprint(w, "\\begin{enumerate}\n")
+	case LISTITEM:
+		_, err = fmt.Fprint(w, "\\item ")
+	case BREAK:
+		_, err = fmt.Fprint(w, n.lineBreak("\\\\\n"))
+	case BLOCKQUOTE, ASIDE:
+		_, err = fmt.Fprint(w, "\\begin{quote}\n")
+	}
+	return err
+}
+
+func (n *node) renderLaTeXEnd(w io.Writer) error {
+	var err error
+	tag := strings.ToLower(n.tagname)
+	switch tag {
+	case H1, H2, H3, H4, H5, H6:
+		_, err = fmt.Fprint(w, "}\n\n")
+	case ANCHOR:
+		_, err = fmt.Fprint(w, "}")
+	case UNORDEREDLIST:
+		_, err = fmt.Fprint(w, "\\end{itemize}\n")
+	case ORDEREDLIST:
+		_, err = fmt.Fprint(w, "\\end{enumerate}\n")
+	case LISTITEM:
+		// a nested list already ends the line
+		if !n.lastChild.isList() {
+			_, err = fmt.Fprint(w, "\n")
+		}
+	case BLOCKQUOTE, ASIDE:
+		_, err = fmt.Fprint(w, "\n\\end{quote}\n")
+	case PARAGRAPH:
+		_, err = fmt.Fprint(w, "\n")
+	default:
+		if _, ok := latexCommands[tag]; ok {
+			_, err = fmt.Fprint(w, "}")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if env, ok := latexAlignments[n.attributes[textAlignAttribute]]; ok &&
+		n.isMarkupSection() {
+		_, err = fmt.Fprintf(w, "\\end{%s}\n", env)
+		if err != nil {
+			return err
+		}
+	}
+	if n.parent != nil && n.parent.tagname == rootTag {
+		switch tag {
+		case H1, H2, H3, H4, H5, H6:
+			// headings already end with a blank line
+		case PARAGRAPH, BLOCKQUOTE, ASIDE, ORDEREDLIST, UNORDEREDLIST:
+			_, err = fmt.Fprint(w, "\n")
+		default:
+			// other sections are written as paragraphs
+			_, err = fmt.Fprint(w, "\n\n")
+		}
+	}
+	return err
+}
+
+func (n *node) renderLaTeXContent(w io.Writer) error {
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if c.isList() && strings.ToLower(n.tagname) == LISTITEM {
+			// nested lists start on their own line
+			if _, err := fmt.Fprint(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := c.renderLaTeX(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *node) renderLaTeX(w io.Writer) error {
+	var err error
+	switch strings.ToLower(n.tagname) {
+	case TEXT:
+		_, err = fmt.Fprint(w, latexEscaper.Replace(n.value))
+		return err
+	case rawTag:
+		_, err = fmt.Fprint(w, n.value)
+		return err
+	case rootTag:
+		return n.renderLaTeXContent(w)
+	case cardTag:
+		var b bytes.Buffer
+		if err = n.renderLaTeXContent(&b); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n\n", strings.TrimRight(b.String(), "\n"))
+		return err
+	case IMAGE:
+		return n.renderLaTeXImage(w)
+	}
+
+	if err = n.renderLaTeXStart(w); err != nil {
+		return err
+	}
+
+	if err = n.renderLaTeXContent(w); err != nil {
+		return err
+	}
+
+	return n.renderLaTeXEnd(w)
+}
@@ -0,0 +1,146 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LinkKind identifies what a LinkRef is part of
+type LinkKind int
+
+// Link kinds
+const (
+	// AnchorLink is the href of a link markup
+	AnchorLink LinkKind = iota
+	// ImageLink is the src of an image section
+	ImageLink
+	// CardLink is a URL in the payload of a card
+	CardLink
+)
+
+// String returns the name of the kind
+func (k LinkKind) String() string {
+	switch k {
+	case AnchorLink:
+		return "anchor"
+	case ImageLink:
+		return "image"
+	case CardLink:
+		return "card"
+	}
+	return fmt.Sprintf("LinkKind(%d)", int(k))
+}
+
+// cardLinkKeys are the payload fields holding URLs for the cards that link
+// to other resources
+var cardLinkKeys = map[string][]string{
+	"image":      {"src", "href"},
+	"image-card": {"src", "href"},
+	"bookmark":   {"url"},
+	"embed":      {"url"},
+}
+
+// LinkRef is a URL referenced by a document, along with where it was found
+type LinkRef struct {
+	URL  string
+	Kind LinkKind
+	// Section is the index of the top level section containing the link
+	Section int
+	// Text is the text of an AnchorLink
+	Text string
+	// Card is the name of the card and Key the payload field holding the
+	// URL of a CardLink
+	Card, Key string
+}
+
+// Links returns the links of the document in document order
+func Links(d *Document) []LinkRef {
+	var links []LinkRef
+	_ = visitLinks(d, func(l LinkRef) (string, error) {
+		links = append(links, l)
+		return l.URL, nil
+	})
+	return links
+}
+
+// RewriteLinks returns a Transform that replaces the URL of every link of
+// the document with the one returned by fn
+func RewriteLinks(fn func(l LinkRef) (string, error)) Transform {
+	return func(d *Document) error {
+		return visitLinks(d, fn)
+	}
+}
+
+// visitLinks calls fn for every link of d, setting the URL of the link to
+// the one returned.
+func visitLinks(d *Document, fn func(l LinkRef) (string, error)) error {
+	for i, s := range d.Sections {
+		var err error
+		switch s := s.(type) {
+		case *ImageSection:
+			var src string
+			if src, err = fn(LinkRef{URL: s.Src, Kind: ImageLink, Section: i}); err == nil {
+				s.Src = src
+			}
+		case *CardSection:
+			m, ok := s.Payload.(map[string]interface{})
+			if !ok {
+				break
+			}
+			for _, k := range cardLinkKeys[s.Name] {
+				u, ok := m[k].(string)
+				if !ok || u == "" {
+					continue
+				}
+				l := LinkRef{
+					URL: u, Kind: CardLink, Section: i, Card: s.Name, Key: k,
+				}
+				if u, err = fn(l); err != nil {
+					break
+				}
+				m[k] = u
+			}
+		default:
+			err = walk(s, VisitorFuncs{EnterFunc: func(e Element) error {
+				m, ok := e.(*Markup)
+				if !ok || m.Tag != ANCHOR {
+					return nil
+				}
+				href, ok := m.Attributes["href"]
+				if !ok {
+					return nil
+				}
+				href, err := fn(LinkRef{
+					URL: href, Kind: AnchorLink, Section: i,
+					Text: inlineText(m.Children),
+				})
+				if err != nil {
+					return err
+				}
+				m.Attributes["href"] = href
+				return nil
+			}})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inlineText returns the text of inlines, with line breaks as newlines and
+// leaving out atoms.
+func inlineText(inlines []Inline) string {
+	var b strings.Builder
+	for _, i := range inlines {
+		switch i := i.(type) {
+		case *TextNode:
+			b.WriteString(i.Value)
+		case *Markup:
+			b.WriteString(inlineText(i.Children))
+		case *BreakNode:
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -3,28 +3,245 @@ package mobiledoc
 import (
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// listMarker returns the marker that starts the list item n.
+func (n *node) listMarker() string {
+	if pos, ok := n.attributes["position"]; ok {
+		return pos + ". "
+	}
+	return "* "
+}
+
+// listIndent returns the indentation needed to nest content under all the
+// list items containing n.
+func (n *node) listIndent() string {
+	var indent string
+	for p := n.parent; p != nil; p = p.parent {
+		if strings.ToLower(p.tagname) == LISTITEM {
+			indent += strings.Repeat(" ", len(p.listMarker()))
+		}
+	}
+	return indent
+}
+
 func (n *node) renderListItemStart(w io.Writer) error {
+	_, err := fmt.Fprint(w, n.listIndent(), n.listMarker())
+	return err
+}
+
+// markdownAttributeList returns the attributes of n as an attribute list,
+// with a known text alignment written as a class and invalid names left out.
+func (n *node) markdownAttributeList() string {
+	keys := make([]string, 0, len(n.attributes))
+	for k := range n.attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys)+1)
+	if n.id != "" {
+		parts = append(parts, "#"+n.id)
+	}
+	for _, k := range keys {
+		switch {
+		case k == textAlignAttribute && textAlignments[n.attributes[k]]:
+			parts = append(parts, "."+n.attributes[k])
+			continue
+		case !validAttributeName(k):
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%q", k, n.attributes[k]))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func (n *node) renderSectionAttributesStart(
+	w io.Writer, o *renderOptions,
+) error {
+	if !n.isMarkupSection() || len(n.attributes) == 0 ||
+		o.attributeMode != HTMLAttributes {
+		return nil
+	}
+
 	var err error
-	if pos, ok := n.attributes["position"]; ok {
-		_, err = fmt.Fprintf(w, "%s. ", pos)
-	} else {
-		_, err = fmt.Fprint(w, "* ")
+	if _, err = fmt.Fprint(w, "<div"); err != nil {
+		return err
+	}
+	if err = n.renderHTMLAttributes(w); err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, ">\n\n")
+	return err
+}
+
+func (n *node) renderSectionAttributesEnd(
+	w io.Writer, o *renderOptions,
+) error {
+	if !n.isMarkupSection() || len(n.attributes) == 0 {
+		return nil
+	}
+
+	var err error
+	switch o.attributeMode {
+	case HTMLAttributes:
+		_, err = fmt.Fprint(w, "</div>\n\n")
+	case AttributeLists:
+		switch strings.ToLower(n.tagname) {
+		case H1, H2, H3, H4, H5, H6:
+			_, err = fmt.Fprint(w, " ", n.markdownAttributeList())
+		default:
+			_, err = fmt.Fprint(w, "\n", n.markdownAttributeList())
+		}
+	}
+	return err
+}
+
+// markdownTitle returns the title of a link or image as written after its
+// destination, including the leading space.
+func (n *node) markdownTitle() string {
+	title, ok := n.attributes["title"]
+	if !ok {
+		return ""
+	}
+	return ` "` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+}
+
+// markdownEscaper escapes the Markdown punctuation and HTML in text
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "&", `\&`, "~", `\~`,
+)
+
+// markdownCaption returns caption escaped and emphasized as a paragraph.
+func markdownCaption(caption string) string {
+	return "_" + markdownEscaper.Replace(strings.TrimSpace(caption)) + "_"
+}
+
+func (n *node) renderImage(w io.Writer, o *renderOptions) error {
+	if o.hugo != nil {
+		image, err := o.hugo.image(n.attributes)
+		if err != nil {
+			return fmt.Errorf("unable to render image: %w", err)
+		}
+		_, err = fmt.Fprint(w, image)
+		return err
+	}
+
+	caption, hasCaption := n.attributes["caption"]
+	if hasCaption && o.captionMode == FigureCaptions {
+		return n.renderHTMLImage(w)
+	}
+
+	alt := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(n.attributes["alt"])
+	_, err := fmt.Fprintf(
+		w, "![%s](%s%s)", alt, n.attributes["src"], n.markdownTitle(),
+	)
+	if err == nil && hasCaption && o.captionMode == ParagraphCaptions {
+		_, err = fmt.Fprint(w, "\n\n", markdownCaption(caption))
+	}
+	return err
+}
+
+// linkAttributes are the anchor attributes that have no Markdown syntax
+var linkAttributes = []string{"rel", "target"}
+
+// hasLinkAttributes reports whether the anchor n has attributes that can
+// not be written with the Markdown link syntax.
+func (n *node) hasLinkAttributes() bool {
+	for _, k := range linkAttributes {
+		if _, ok := n.attributes[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// linkAsHTML reports whether the anchor n is written as inline HTML.
+func (n *node) linkAsHTML(o *renderOptions) bool {
+	return o.attributeMode == HTMLAttributes && n.hasLinkAttributes()
+}
+
+func (n *node) renderLinkStart(w io.Writer, o *renderOptions) error {
+	if !n.linkAsHTML(o) {
+		_, err := fmt.Fprint(w, "[")
+		return err
+	}
+
+	var err error
+	if _, err = fmt.Fprint(w, "<a"); err != nil {
+		return err
+	}
+	if err = n.renderHTMLAttributes(w); err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, ">")
+	return err
+}
+
+func (n *node) renderLinkEnd(w io.Writer, o *renderOptions) error {
+	var err error
+	if n.linkAsHTML(o) {
+		_, err = fmt.Fprint(w, "</a>")
+		return err
+	}
+
+	if _, err = fmt.Fprint(w, "]"); err != nil {
+		return err
+	}
+	href, ok := n.attributes["href"]
+	if !ok {
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "(%s%s)", href, n.markdownTitle())
+	if err != nil || o.attributeMode != AttributeLists {
+		return err
+	}
+
+	var parts []string
+	for _, k := range linkAttributes {
+		if v, ok := n.attributes[k]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%q", k, v))
+		}
+	}
+	if len(parts) > 0 {
+		_, err = fmt.Fprint(w, "{"+strings.Join(parts, " ")+"}")
 	}
 	return err
 }
 
-func (n *node) renderStart(w io.Writer) error {
+func (n *node) renderLineBreak(w io.Writer, o *renderOptions) error {
 	var err error
+	switch {
+	case n.endsBlock():
+		// a line break at the end of a block has no effect
+	case n.inHeading():
+		// headings are a single line, which inline HTML can break
+		_, err = fmt.Fprint(w, "<br>")
+	case o.lineBreakMode == BackslashLineBreaks:
+		_, err = fmt.Fprint(w, "\\\n", n.listIndent())
+	default:
+		_, err = fmt.Fprint(w, "  \n", n.listIndent())
+	}
+	return err
+}
+
+func (n *node) renderStart(w io.Writer, o *renderOptions) error {
+	err := n.renderSectionAttributesStart(w, o)
+	if err != nil {
+		return err
+	}
+
 	switch strings.ToLower(n.tagname) {
-	case BOLD, STRONG:
-		_, err = fmt.Fprint(w, "**")
+	case BOLD, STRONG, ITALIC, EMPHASIS:
+		open, _ := n.emphasisDelimiters()
+		_, err = fmt.Fprint(w, open)
 	case CODE:
 		_, err = fmt.Fprint(w, "`")
-	case ITALIC, EMPHASIS:
-		_, err = fmt.Fprint(w, "_")
 	case H1:
 		_, err = fmt.Fprint(w, "# ")
 	case H2:
@@ -33,121 +250,328 @@ func (n *node) renderStart(w io.Writer) error {
 		_, err = fmt.Fprint(w, "### ")
 	case H4:
 		_, err = fmt.Fprint(w, "#### ")
+	case H5:
+		_, err = fmt.Fprint(w, "##### ")
+	case H6:
+		_, err = fmt.Fprint(w, "###### ")
 	case ANCHOR:
-		_, err = fmt.Fprint(w, "[")
+		err = n.renderLinkStart(w, o)
 	case IMAGE:
-		_, err = fmt.Fprint(w, "![")
+		err = n.renderImage(w, o)
 	case LISTITEM:
 		err = n.renderListItemStart(w)
 	case BLOCKQUOTE:
 		_, err = fmt.Fprint(w, "> ")
+	case BREAK:
+		err = n.renderLineBreak(w, o)
 	}
 
 	return err
 }
 
-func (n *node) renderEnd(w io.Writer) error {
+func (n *node) renderEnd(w io.Writer, o *renderOptions) error {
 	var err error
+	if o.attributeMode == AttributeLists {
+		if err = n.renderSectionAttributesEnd(w, o); err != nil {
+			return err
+		}
+	}
+	if n.id != "" && (o.attributeMode != AttributeLists || len(n.attributes) == 0) {
+		// the ID is written on its own when not part of an attribute list
+		if _, err = fmt.Fprintf(w, " {#%s}", n.id); err != nil {
+			return err
+		}
+	}
+
 	switch strings.ToLower(n.tagname) {
-	case BOLD, STRONG:
-		_, err = fmt.Fprint(w, "**")
+	case BOLD, STRONG, ITALIC, EMPHASIS:
+		_, end := n.emphasisDelimiters()
+		_, err = fmt.Fprint(w, end)
 	case CODE:
 		_, err = fmt.Fprint(w, "`")
-	case ITALIC, EMPHASIS:
-		_, err = fmt.Fprint(w, "_")
 	case ANCHOR:
-		if _, err = fmt.Fprint(w, "]"); err != nil {
-			return err
-		}
-		if href, ok := n.attributes["href"]; ok {
-			_, err = fmt.Fprintf(w, "(%s)", href)
-		}
+		err = n.renderLinkEnd(w, o)
 	case IMAGE:
-		if _, err = fmt.Fprint(w, "]"); err != nil {
-			return err
+		_, err = fmt.Fprint(w, "\n\n")
+	case LISTITEM:
+		// a nested list already ends the line
+		if !n.lastChild.isList() {
+			_, err = fmt.Fprint(w, "\n")
 		}
-		if src, ok := n.attributes["src"]; ok {
-			_, err = fmt.Fprintf(w, "(%s)", src)
+	case ORDEREDLIST, UNORDEREDLIST:
+		if n.parent == nil || strings.ToLower(n.parent.tagname) != LISTITEM {
+			_, err = fmt.Fprint(w, "\n")
 		}
-	case LISTITEM, ORDEREDLIST, UNORDEREDLIST:
-		_, err = fmt.Fprint(w, "\n")
-	case H1, H2, H3, H4, PARAGRAPH, BLOCKQUOTE, DIV:
+	case H1, H2, H3, H4, H5, H6, PARAGRAPH, BLOCKQUOTE, ASIDE, DIV, cardTag:
 		_, err = fmt.Fprint(w, "\n\n")
+	default:
+		// other sections are written as paragraphs
+		if n.parent != nil && n.parent.tagname == rootTag {
+			_, err = fmt.Fprint(w, "\n\n")
+		}
+	}
+	if err != nil {
+		return err
 	}
 
+	if o.attributeMode == HTMLAttributes {
+		err = n.renderSectionAttributesEnd(w, o)
+	}
 	return err
 }
 
-func (n *node) rednerSpaceStart(w io.Writer) error {
-	var err error
-
+// isEmphasis reports whether n is written between emphasis delimiters.
+func (n *node) isEmphasis() bool {
 	switch strings.ToLower(n.tagname) {
-	case LISTITEM, ORDEREDLIST, UNORDEREDLIST, H1, H2, H3, H4, PARAGRAPH, BLOCKQUOTE, DIV:
-		// do nothing
-	default:
-		for ; n != nil; n = n.lastChild {
-			if strings.HasPrefix(n.value, " ") {
-				_, err = fmt.Fprint(w, " ")
-				break
-			}
+	case BOLD, STRONG, ITALIC, EMPHASIS:
+		return true
+	}
+	return false
+}
+
+// moveSpaceOutside moves the whitespace at the start and end of emphasis
+// out of its delimiters, which CommonMark only recognizes next to text, and
+// drops the whitespace at the start and end of blocks. All other whitespace
+// is left as it is.
+func (n *node) moveSpaceOutside() {
+	for c := n.firstChild; c != nil; {
+		next := c.nextSibling
+		c.moveSpaceOutside()
+		c = next
+	}
+
+	switch {
+	case n.isEmphasis():
+		if lead := n.cutLeadingSpace(); lead != "" {
+			n.parent.insertBefore(newNode(TEXT, lead), n)
+		}
+		if trail := n.cutTrailingSpace(); trail != "" {
+			n.parent.insertBefore(newNode(TEXT, trail), n.nextSibling)
 		}
+		if n.firstChild == nil {
+			n.parent.removeChild(n)
+		}
+	case n.tagname != TEXT && n.tagname != rawTag && !isInlineMarkup(n.tagname):
+		n.cutLeadingSpace()
+		n.cutTrailingSpace()
 	}
+}
 
-	return err
+// cutLeadingSpace removes the whitespace at the start of the text of n and
+// returns it.
+func (n *node) cutLeadingSpace() string {
+	var cut string
+	for c := n.firstChild; c != nil && c.tagname == TEXT; c = n.firstChild {
+		trimmed := strings.TrimLeftFunc(c.value, unicode.IsSpace)
+		cut += c.value[:len(c.value)-len(trimmed)]
+		if trimmed != "" {
+			c.value = trimmed
+			break
+		}
+		n.removeChild(c)
+	}
+	return cut
 }
 
-func (n *node) rednerSpaceEnd(w io.Writer) error {
-	var err error
+// cutTrailingSpace removes the whitespace at the end of the text of n,
+// before any nested lists, and returns it.
+func (n *node) cutTrailingSpace() string {
+	last := n.lastChild
+	for last.isList() {
+		last = last.prevSibling
+	}
 
-	switch strings.ToLower(n.tagname) {
-	case LISTITEM, ORDEREDLIST, UNORDEREDLIST, H1, H2, H3, H4, PARAGRAPH, BLOCKQUOTE, DIV:
-		// do nothing
-	default:
-		for ; n != nil; n = n.lastChild {
-			if strings.HasSuffix(n.value, " ") {
-				_, err = fmt.Fprint(w, " ")
-				break
+	var cut string
+	for last != nil && last.tagname == TEXT {
+		trimmed := strings.TrimRightFunc(last.value, unicode.IsSpace)
+		cut = last.value[len(trimmed):] + cut
+		if trimmed != "" {
+			last.value = trimmed
+			break
+		}
+		prev := last.prevSibling
+		n.removeChild(last)
+		last = prev
+	}
+	return cut
+}
+
+// sibling returns the next sibling of n, or the previous one when next is
+// false.
+func (n *node) sibling(next bool) *node {
+	if next {
+		return n.nextSibling
+	}
+	return n.prevSibling
+}
+
+// delimiterRune returns the rune n is opened with, or closed with when
+// closing is true, if it is written between delimiters.
+func (n *node) delimiterRune(closing bool) (rune, bool) {
+	switch {
+	case n.isEmphasis():
+		return '*', true
+	case strings.ToLower(n.tagname) == CODE:
+		return '`', true
+	case strings.ToLower(n.tagname) == ANCHOR && closing:
+		return ')', true
+	case strings.ToLower(n.tagname) == ANCHOR:
+		return '[', true
+	}
+	return 0, false
+}
+
+// edgeRune returns the first rune written for n, or the last one when last
+// is true, reporting false when nothing is written.
+func (n *node) edgeRune(last bool) (rune, bool) {
+	if r, ok := n.delimiterRune(last); ok {
+		return r, true
+	}
+
+	switch {
+	case n.tagname == TEXT || n.tagname == rawTag:
+		value := n.value
+		if n.tagname == rawTag {
+			value = strings.TrimSpace(value)
+		}
+		if value == "" {
+			return 0, false
+		}
+		if last {
+			r, _ := utf8.DecodeLastRuneInString(value)
+			return r, true
+		}
+		r, _ := utf8.DecodeRuneInString(value)
+		return r, true
+	case !isInlineMarkup(n.tagname):
+		// a nested list starts on a new line
+		return '\n', true
+	}
+	return n.innerRune(last)
+}
+
+// innerRune returns the first rune written for the children of n, or the
+// last one when last is true.
+func (n *node) innerRune(last bool) (rune, bool) {
+	c := n.firstChild
+	if last {
+		c = n.lastChild
+	}
+	for ; c != nil; c = c.sibling(!last) {
+		if r, ok := c.edgeRune(last); ok {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// outerRune returns the rune written before n, or after it when after is
+// true, with 0 for the start or end of a line.
+func (n *node) outerRune(after bool) rune {
+	for c := n; c.parent != nil; c = c.parent {
+		for s := c.sibling(after); s != nil; s = s.sibling(after) {
+			if r, ok := s.edgeRune(!after); ok {
+				return r
 			}
 		}
+		if r, ok := c.parent.delimiterRune(after); ok {
+			return r
+		}
+		if !isInlineMarkup(c.parent.tagname) {
+			break
+		}
 	}
+	return 0
+}
 
-	return err
+// isMarkdownPunct reports whether r is punctuation for CommonMark.
+func isMarkdownPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
 }
 
-func (n *node) renderContent(w io.Writer) error {
+// flanking reports whether a delimiter run between before and after is left
+// flanking and right flanking, with 0 for the start or end of a line.
+func flanking(before, after rune) (left, right bool) {
+	beforeSpace := before == 0 || unicode.IsSpace(before)
+	afterSpace := after == 0 || unicode.IsSpace(after)
+	left = !afterSpace &&
+		(!isMarkdownPunct(after) || beforeSpace || isMarkdownPunct(before))
+	right = !beforeSpace &&
+		(!isMarkdownPunct(before) || afterSpace || isMarkdownPunct(after))
+	return left, right
+}
+
+// canEmphasize reports whether text starting with first and ending with last
+// is emphasized by the delimiter d when written between before and after.
+func canEmphasize(d, before, first, last, after rune) bool {
+	openLeft, openRight := flanking(before, first)
+	closeLeft, closeRight := flanking(last, after)
+	if d == '_' {
+		// underscores do not emphasize within words
+		return openLeft && (!openRight || isMarkdownPunct(before)) &&
+			closeRight && (!closeLeft || isMarkdownPunct(after))
+	}
+	return openLeft && closeRight
+}
+
+// emphasisDelimiters returns the delimiters written around the emphasis n,
+// falling back to HTML when no Markdown delimiter would be recognized.
+func (n *node) emphasisDelimiters() (string, string) {
+	before, after := n.outerRune(false), n.outerRune(true)
+	first, _ := n.innerRune(false)
+	last, _ := n.innerRune(true)
+
+	switch strings.ToLower(n.tagname) {
+	case BOLD, STRONG:
+		if canEmphasize('*', before, first, last, after) {
+			return "**", "**"
+		}
+		return "<strong>", "</strong>"
+	}
+	if canEmphasize('_', before, first, last, after) {
+		return "_", "_"
+	}
+	if canEmphasize('*', before, first, last, after) {
+		return "*", "*"
+	}
+	return "<em>", "</em>"
+}
+
+func (n *node) renderContent(w io.Writer, o *renderOptions) error {
 	var err error
 	if n.value != "" {
-		_, err = fmt.Fprint(w, strings.TrimSpace(n.value))
+		value := n.value
+		if n.tagname == rawTag {
+			// cards and atoms are trimmed, text is written as it is
+			value = strings.TrimSpace(value)
+		}
+		_, err = fmt.Fprint(w, value)
 		return err
 	}
 	for c := n.firstChild; c != nil; c = c.nextSibling {
-		if c != n.firstChild {
-			if err = c.rednerSpaceStart(w); err != nil {
+		if c.isList() && strings.ToLower(n.tagname) == LISTITEM {
+			// nested lists start on their own line
+			if _, err = fmt.Fprint(w, "\n"); err != nil {
 				return err
 			}
 		}
-		if err = c.renderMarkdown(w); err != nil {
+		if err = c.renderMarkdown(w, o); err != nil {
 			return err
 		}
-		if c.nextSibling != nil {
-			if err = c.rednerSpaceEnd(w); err != nil {
-				return err
-			}
-		}
 	}
 	return err
 }
 
-func (n *node) renderMarkdown(w io.Writer) error {
+func (n *node) renderMarkdown(w io.Writer, o *renderOptions) error {
 	var err error
-	if err = n.renderStart(w); err != nil {
+	if err = n.renderStart(w, o); err != nil {
 		return err
 	}
 
-	if err = n.renderContent(w); err != nil {
+	if err = n.renderContent(w, o); err != nil {
 		return err
 	}
 
-	err = n.renderEnd(w)
+	err = n.renderEnd(w, o)
 	return err
 }
@@ -21,76 +21,341 @@ const (
 	sectionCard   = 10
 )
 
+// Format identifies the output format a Mobiledoc is rendered to
+type Format int
+
+// Output formats
+const (
+	Markdown Format = iota
+	HTML
+	AsciiDoc
+	RST
+	Org
+	Gemtext
+	LaTeX
+	// JSON writes the parsed Document rather than rendering it, see Document
+	// for the structure
+	JSON
+)
+
+// String returns the name of the format
+func (f Format) String() string {
+	switch f {
+	case Markdown:
+		return "markdown"
+	case HTML:
+		return "html"
+	case AsciiDoc:
+		return "asciidoc"
+	case RST:
+		return "rst"
+	case Org:
+		return "org"
+	case Gemtext:
+		return "gemtext"
+	case LaTeX:
+		return "latex"
+	case JSON:
+		return "json"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// AttributeMode selects how attributes that have no Markdown syntax of their
+// own are written to Markdown
+type AttributeMode int
+
+// Attribute modes
+const (
+	// DropAttributes leaves the attributes out of the output
+	DropAttributes AttributeMode = iota
+	// HTMLAttributes wraps the content in inline HTML carrying the attributes
+	HTMLAttributes
+	// AttributeLists writes attribute lists such as {.center}, as understood
+	// by Goldmark, Kramdown and Pandoc
+	AttributeLists
+)
+
+// CaptionMode selects how image captions are written to Markdown
+type CaptionMode int
+
+// Caption modes
+const (
+	// ParagraphCaptions writes the caption as an emphasized paragraph
+	// following the image
+	ParagraphCaptions CaptionMode = iota
+	// FigureCaptions writes captioned images as an inline HTML figure
+	FigureCaptions
+	// DropCaptions leaves captions out of the output
+	DropCaptions
+)
+
+// LineBreakMode selects how line breaks are written to Markdown
+type LineBreakMode int
+
+// Line break modes
+const (
+	// SpaceLineBreaks ends the line with two spaces
+	SpaceLineBreaks LineBreakMode = iota
+	// BackslashLineBreaks ends the line with a backslash, which is visible
+	// where trailing spaces are not
+	BackslashLineBreaks
+)
+
+// renderOptions holds the settings that change how nodes are rendered
+type renderOptions struct {
+	attributeMode  AttributeMode
+	captionMode    CaptionMode
+	lineBreakMode  LineBreakMode
+	hugo           *HugoShortcodes
+	highlighter    Highlighter
+	markdownEngine MarkdownEngine
+	sanitizer      Sanitizer
+}
+
 // Mobiledoc models the data required to render a mobiledoc document
 type Mobiledoc struct {
-	r     io.Reader
-	atoms map[string]Atom
-	cards map[string]Card
-	doc   doc
-	root  *node
+	r           io.Reader
+	format      Format
+	opts        renderOptions
+	atoms       map[string]atomRenderer
+	cards       map[string]cardRenderer
+	formatAtoms map[Format]map[string]atomRenderer
+	formatCards map[Format]map[string]cardRenderer
+	transforms  []Transform
+	headingSlug SlugFunc
+	mdmap       map[string]json.RawMessage
 }
 
 // NewMobiledoc creates a new Mobiledoc instance
 func NewMobiledoc(src io.Reader) Mobiledoc {
 	return Mobiledoc{
-		r: src,
-		cards: map[string]Card{
-			"image-card": imagecard,
-		},
+		r:      src,
+		format: Markdown,
+	}
+}
+
+// WithFormat creates a new Mobiledoc instance that renders to the given format
+func (md Mobiledoc) WithFormat(format Format) Mobiledoc {
+	md.format = format
+	return md
+}
+
+// WithAttributeMode creates a new Mobiledoc instance that writes attributes
+// to Markdown using the given mode
+func (md Mobiledoc) WithAttributeMode(mode AttributeMode) Mobiledoc {
+	md.opts.attributeMode = mode
+	return md
+}
+
+// WithCaptionMode creates a new Mobiledoc instance that writes image
+// captions to Markdown using the given mode
+func (md Mobiledoc) WithCaptionMode(mode CaptionMode) Mobiledoc {
+	md.opts.captionMode = mode
+	return md
+}
+
+// WithLineBreakMode creates a new Mobiledoc instance that writes line
+// breaks to Markdown using the given mode
+func (md Mobiledoc) WithLineBreakMode(mode LineBreakMode) Mobiledoc {
+	md.opts.lineBreakMode = mode
+	return md
+}
+
+// WithHugo creates a new Mobiledoc instance that writes Markdown for Hugo,
+// using shortcodes, or the templates given, for images, galleries, embeds,
+// code and callouts
+func (md Mobiledoc) WithHugo(shortcodes HugoShortcodes) Mobiledoc {
+	shortcodes = shortcodes.withDefaults()
+	md.opts.hugo = &shortcodes
+	return md
+}
+
+// WithHighlighter creates a new Mobiledoc instance that highlights the code
+// of code cards rendered to HTML with h, or a ClassHighlighter when nil
+func (md Mobiledoc) WithHighlighter(h Highlighter) Mobiledoc {
+	if h == nil {
+		h = ClassHighlighter{}
+	}
+	md.opts.highlighter = h
+	return md
+}
+
+// WithHeadingIDs creates a new Mobiledoc instance that gives headings the
+// IDs generated by slug, or Slugify when nil, as returned by Headings. The
+// IDs are written to HTML as id attributes and to Markdown as {#id}.
+func (md Mobiledoc) WithHeadingIDs(slug SlugFunc) Mobiledoc {
+	if slug == nil {
+		slug = Slugify
 	}
+	md.headingSlug = slug
+	return md
 }
 
 // WithAtom creates a new Mobiledoc instance that has a registered Atom
+//
+// The Atom is used for every format that does not have an Atom of the same
+// name registered with WithFormatAtom.
 func (md Mobiledoc) WithAtom(name string, atom Atom) Mobiledoc {
+	return md.withAtom(name, atom.renderer())
+}
+
+func (md Mobiledoc) withAtom(name string, atom atomRenderer) Mobiledoc {
 	if md.atoms == nil {
-		md.atoms = make(map[string]Atom)
+		md.atoms = make(map[string]atomRenderer)
 	}
 	md.atoms[name] = atom
 	return md
 }
 
 // WithCard creates a new Mobiledoc instance that has a registered Card
+//
+// The Card is used for every format that does not have a Card of the same
+// name registered with WithFormatCard.
 func (md Mobiledoc) WithCard(name string, card Card) Mobiledoc {
+	return md.withCard(name, card.renderer())
+}
+
+func (md Mobiledoc) withCard(name string, card cardRenderer) Mobiledoc {
 	if md.cards == nil {
-		md.cards = make(map[string]Card)
+		md.cards = make(map[string]cardRenderer)
 	}
 	md.cards[name] = card
 	return md
 }
 
-// Render the Mobiledoc is rendered to the given writer
-func (md *Mobiledoc) Render(w io.Writer) error {
-	if md.root != nil {
-		return md.root.renderMarkdown(w)
+// WithFormatAtom creates a new Mobiledoc instance that has a registered Atom
+// for a single format
+func (md Mobiledoc) WithFormatAtom(
+	format Format, name string, atom Atom,
+) Mobiledoc {
+	return md.withFormatAtom(format, name, atom.renderer())
+}
+
+func (md Mobiledoc) withFormatAtom(
+	format Format, name string, atom atomRenderer,
+) Mobiledoc {
+	if md.formatAtoms == nil {
+		md.formatAtoms = make(map[Format]map[string]atomRenderer)
+	}
+	if md.formatAtoms[format] == nil {
+		md.formatAtoms[format] = make(map[string]atomRenderer)
 	}
+	md.formatAtoms[format][name] = atom
+	return md
+}
 
-	var mdmap map[string]json.RawMessage
-	decoder := json.NewDecoder(md.r)
-	err := decoder.Decode(&mdmap)
-	if err != nil {
-		return fmt.Errorf("unable to decode mobiledoc json: %w", err)
+// WithFormatCard creates a new Mobiledoc instance that has a registered Card
+// for a single format
+func (md Mobiledoc) WithFormatCard(
+	format Format, name string, card Card,
+) Mobiledoc {
+	return md.withFormatCard(format, name, card.renderer())
+}
+
+func (md Mobiledoc) withFormatCard(
+	format Format, name string, card cardRenderer,
+) Mobiledoc {
+	if md.formatCards == nil {
+		md.formatCards = make(map[Format]map[string]cardRenderer)
+	}
+	if md.formatCards[format] == nil {
+		md.formatCards[format] = make(map[string]cardRenderer)
+	}
+	md.formatCards[format][name] = card
+	return md
+}
+
+// Parse parses the Mobiledoc into a Document, leaving cards and atoms
+// unrendered
+func (md *Mobiledoc) Parse() (*Document, error) {
+	if md.mdmap == nil {
+		var mdmap map[string]json.RawMessage
+		decoder := json.NewDecoder(md.r)
+		err := decoder.Decode(&mdmap)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode mobiledoc json: %w", err)
+		}
+		md.mdmap = mdmap
 	}
 
-	verInt, ok := mdmap["version"]
+	verInt, ok := md.mdmap["version"]
 	if !ok {
-		return errors.New("not valid mobiledoc: version not found")
+		return nil, errors.New("not valid mobiledoc: version not found")
 	}
 
 	var version string
-	err = json.Unmarshal(verInt, &version)
+	err := json.Unmarshal(verInt, &version)
 	if err != nil {
-		return fmt.Errorf("not valid mobiledoc: version string: %w", err)
+		return nil, fmt.Errorf("not valid mobiledoc: version string: %w", err)
 	}
 
+	var document *Document
 	switch version {
 	case "0.3.0", "0.3.1", "0.3.2":
-		n, err := md.parseV03(mdmap)
+		document, err = parseV03(md.mdmap)
 		if err != nil {
-			return fmt.Errorf("unable to parse mobiledoc: %w", err)
+			return nil, fmt.Errorf("unable to parse mobiledoc: %w", err)
 		}
-		md.root = n
 	default:
-		return fmt.Errorf("unknown version %s", version)
+		return nil, fmt.Errorf("unknown version %s", version)
+	}
+	document.Version = version
+	return document, nil
+}
+
+// Render the Mobiledoc is rendered to the given writer
+func (md *Mobiledoc) Render(w io.Writer) error {
+	document, err := md.Parse()
+	if err != nil {
+		return err
+	}
+	return md.RenderDocument(w, document)
+}
+
+// RenderDocument applies the transforms and renders the given document,
+// such as one parsed earlier, to the writer instead of the source of the
+// Mobiledoc. The transforms are applied to a copy, leaving the document as
+// it is.
+func (md *Mobiledoc) RenderDocument(w io.Writer, document *Document) error {
+	if len(md.transforms) > 0 {
+		document = document.clone()
+	}
+	err := md.transform(document)
+	if err != nil {
+		return err
+	}
+
+	if md.format == JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document)
+	}
+
+	root, err := md.buildTree(document)
+	if err != nil {
+		return fmt.Errorf("unable to parse mobiledoc: %w", err)
+	}
+	if md.opts.sanitizer != nil {
+		root.dropUnsafeURLs()
+	}
+
+	switch md.format {
+	case Markdown:
+		root.moveSpaceOutside()
+		return root.renderMarkdown(w, &md.opts)
+	case HTML:
+		return root.renderHTML(w)
+	case AsciiDoc:
+		return root.renderAsciiDoc(w)
+	case RST:
+		return root.renderRST(w)
+	case Org:
+		return root.renderOrg(w)
+	case Gemtext:
+		return root.renderGemtext(w)
+	case LaTeX:
+		return root.renderLaTeX(w)
 	}
-	return md.root.renderMarkdown(w)
+	return fmt.Errorf("unknown format %s", md.format)
 }
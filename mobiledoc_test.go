@@ -2,15 +2,20 @@ package mobiledoc
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"testing"
+	texttemplate "text/template"
+	"time"
 )
 
 var updateFlag bool
@@ -26,70 +31,1263 @@ func init() {
 }
 
 func render(t *testing.T, md Mobiledoc, w *bytes.Buffer, wantFile string) {
-	var err error
-	if err = md.Render(w); err != nil {
+	if err := md.Render(w); err != nil {
 		t.Errorf("Render() error = %v, want nil", err)
 		return
 	}
+	compareGolden(t, w.Bytes(), wantFile)
+}
+
+// compareGolden compares got with the content of wantFile, first replacing
+// the content with got when the update flag is set.
+func compareGolden(t *testing.T, got []byte, wantFile string) {
+	t.Helper()
+	var err error
+	if updateFlag {
+		var f *os.File
+		f, err = os.Create(wantFile)
+		if err != nil {
+			t.Fatalf("os.Create() err = %s; want nil", err)
+		}
+		f.Write(got)
+		f.Close()
+	}
+
+	f, err := os.Open(wantFile)
+	if err != nil {
+		t.Fatalf("os.Open() err = %s; want nil", err)
+	}
+	want, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll() err = %s; want nil", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []string{
+		"empty_0.3.0",
+		"empty_0.3.1",
+		"empty_0.3.2",
+		"image_section_0.3.0",
+		"image_section_0.3.1",
+		"without_markup_0.3.0",
+		"without_markup_0.3.1",
+		"simple_markup_0.3.0",
+		"simple_markup_0.3.1",
+		"attribute_markup_0.3.0",
+		"attribute_markup_0.3.1",
+		"multi_marker_section_0.3.1",
+		"list_section_0.3.1",
+		"image_card_0.3.1",
+		"section_attributes_0.3.2",
+		"nested_list_0.3.2",
+		"link_attributes_0.3.2",
+		"image_card_caption_0.3.1",
+		"whitespace_0.3.1",
+		"image_card_no_src_0.3.1",
+		"blocks_0.3.2",
+	}
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", "markdown", tt+".golden")
+			r, err := os.Open(filepath.Join("testdata", tt+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r)
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestRender_html(t *testing.T) {
+	tests := []string{
+		"empty_0.3.2",
+		"image_section_0.3.1",
+		"without_markup_0.3.1",
+		"simple_markup_0.3.1",
+		"attribute_markup_0.3.1",
+		"multi_marker_section_0.3.1",
+		"list_section_0.3.1",
+		"image_card_0.3.1",
+		"section_attributes_0.3.2",
+		"nested_list_0.3.2",
+		"aligned_sections_0.3.2",
+		"link_attributes_0.3.2",
+		"image_card_caption_0.3.1",
+		"hostile_markup_0.3.2",
+		"image_card_no_src_0.3.1",
+	}
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", "html", tt+".golden")
+			r, err := os.Open(filepath.Join("testdata", tt+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithFormat(HTML)
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestRender_attributeMode(t *testing.T) {
+	modes := []struct {
+		name string
+		mode AttributeMode
+	}{
+		{"drop", DropAttributes},
+		{"html", HTMLAttributes},
+		{"attribute_lists", AttributeLists},
+	}
+	tests := []string{
+		"aligned_sections_0.3.2",
+		"link_attributes_0.3.2",
+	}
+	for _, tt := range tests {
+		for _, m := range modes {
+			t.Run(tt+"/"+m.name, func(t *testing.T) {
+				w := &bytes.Buffer{}
+				wantFile := filepath.Join(
+					"testdata", "markdown", tt+"."+m.name+".golden",
+				)
+				r, err := os.Open(filepath.Join("testdata", tt+".json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				md := NewMobiledoc(r).WithAttributeMode(m.mode)
+
+				render(t, md, w, wantFile)
+			})
+		}
+	}
+}
+
+func TestRender_captionMode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode CaptionMode
+	}{
+		{"paragraph", ParagraphCaptions},
+		{"figure", FigureCaptions},
+		{"drop", DropCaptions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join(
+				"testdata", "markdown",
+				"image_card_caption_0.3.1."+tt.name+".golden",
+			)
+			r, err := os.Open(
+				filepath.Join("testdata", "image_card_caption_0.3.1.json"),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithCaptionMode(tt.mode)
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestRender_transforms(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []Transform
+	}{
+		{"none", nil},
+		{"all", []Transform{
+			ReplaceImageHost("cdn.example.com", "images.example.org"),
+			StripEmptyParagraphs,
+			DemoteHeadings(1),
+			MergeMarkups,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join(
+				"testdata", "markdown", "transform_0.3.1."+tt.name+".golden",
+			)
+			r, err := os.Open(filepath.Join("testdata", "transform_0.3.1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithTransform(tt.transforms...)
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestRenderDocument_transformCopy(t *testing.T) {
+	d := parseFile(t, "transform_0.3.1")
+	want, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := NewMobiledoc(nil).WithTransform(
+		ReplaceImageHost("cdn.example.com", "images.example.org"),
+		StripEmptyParagraphs,
+		DemoteHeadings(1),
+		MergeMarkups,
+		Excerpt(ExcerptOptions{Words: 3}),
+	)
+	if err = md.RenderDocument(ioutil.Discard, d); err != nil {
+		t.Fatalf("RenderDocument() err = %v, want nil", err)
+	}
+
+	got, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("RenderDocument() changed the document\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestRender_normalize(t *testing.T) {
+	for _, format := range []Format{JSON, Markdown} {
+		t.Run(format.String(), func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join(
+				"testdata", format.String(), "normalize_0.3.1.golden",
+			)
+			r, err := os.Open(filepath.Join("testdata", "normalize_0.3.1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithFormat(format).WithTransform(Normalize)
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestRender_lineBreaks(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		mode     LineBreakMode
+		wantFile string
+	}{
+		{"markdown", Markdown, SpaceLineBreaks, "breaks_0.3.1.golden"},
+		{"backslash", Markdown, BackslashLineBreaks, "breaks_0.3.1.backslash.golden"},
+		{"html", HTML, SpaceLineBreaks, "breaks_0.3.1.golden"},
+		{"asciidoc", AsciiDoc, SpaceLineBreaks, "breaks_0.3.1.golden"},
+		{"rst", RST, SpaceLineBreaks, "breaks_0.3.1.golden"},
+		{"org", Org, SpaceLineBreaks, "breaks_0.3.1.golden"},
+		{"gemtext", Gemtext, SpaceLineBreaks, "breaks_0.3.1.golden"},
+		{"latex", LaTeX, SpaceLineBreaks, "breaks_0.3.1.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", tt.format.String(), tt.wantFile)
+			r, err := os.Open(filepath.Join("testdata", "breaks_0.3.1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithFormat(tt.format).WithLineBreakMode(tt.mode)
+
+			render(t, md, w, wantFile)
+		})
+	}
+
+	want := "First line\nsecond\nline\n\nTwo\nlines\n\nQuoted\nverse\n\n" +
+		"item\ncontinued\ntrailing\n"
+	if got := PlainText(parseFile(t, "breaks_0.3.1")); got != want {
+		t.Errorf("PlainText() = %q, want %q", got, want)
+	}
+}
+
+func TestRender_code(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		h        Highlighter
+		wantFile string
+	}{
+		{"markdown", Markdown, nil, "code_0.3.1.golden"},
+		{"html", HTML, nil, "code_0.3.1.golden"},
+		{"highlighted", HTML, ClassHighlighter{}, "code_0.3.1.highlighted.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", tt.format.String(), tt.wantFile)
+			r, err := os.Open(filepath.Join("testdata", "code_0.3.1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithFormat(tt.format)
+			if tt.h != nil {
+				md = md.WithHighlighter(tt.h)
+			}
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestRender_highlighterError(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "code_0.3.1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFailed := fmt.Errorf("failed")
+	md := NewMobiledoc(r).
+		WithFormat(HTML).
+		WithHighlighter(HighlighterFunc(func(code, language string) (string, error) {
+			return "", errFailed
+		}))
+	if err := md.Render(ioutil.Discard); !errors.Is(err, errFailed) {
+		t.Errorf("Render() error = %v, want %v", err, errFailed)
+	}
+}
+
+func TestClassHighlighter(t *testing.T) {
+	tests := []struct {
+		code, language, prefix string
+		want                   string
+	}{
+		{"x := 1 // one", "go", "",
+			`x := <span class="hl-number">1</span> <span class="hl-comment">// one</span>`},
+		{`return "a\"b" < c`, "js", "",
+			`<span class="hl-keyword">return</span> <span class="hl-string">&#34;a\&#34;b&#34;</span> &lt; c`},
+		{"/* open", "c", "tok-", `<span class="tok-comment">/* open</span>`},
+		{"def f(): pass", "Python", "",
+			`<span class="hl-keyword">def</span> f(): <span class="hl-keyword">pass</span>`},
+		{"select * From t", "sql", "",
+			`<span class="hl-keyword">select</span> * <span class="hl-keyword">From</span> t`},
+		{"if <x>", "unknown", "", "if &lt;x&gt;"},
+	}
+	for _, tt := range tests {
+		got, err := ClassHighlighter{Prefix: tt.prefix}.Highlight(tt.code, tt.language)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Highlight(%q, %q) = %q, want %q", tt.code, tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	tests := []struct {
+		code, info, want string
+	}{
+		{"plain", "go", "```"},
+		{"a ``` b", "", "````"},
+		{"a ````` b `", "md", "``````"},
+		{"a ~~~ b", "weird`info", "~~~~"},
+	}
+	for _, tt := range tests {
+		if got := codeFence(tt.code, tt.info); got != tt.want {
+			t.Errorf("codeFence(%q, %q) = %q, want %q", tt.code, tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestRender_embedded(t *testing.T) {
+	// engine stands in for a Markdown library, converting only bold text
+	engine := MarkdownEngineFunc(func(markdown string) (string, error) {
+		bold := regexp.MustCompile(`\*\*(.+?)\*\*`)
+		return "<p>" + bold.ReplaceAllString(markdown, "<strong>$1</strong>") + "</p>", nil
+	})
+
+	tests := []struct {
+		name      string
+		format    Format
+		sanitizer Sanitizer
+		wantFile  string
+	}{
+		{"markdown", Markdown, nil, "embedded_0.3.1.golden"},
+		{"sanitized", Markdown, AllowlistSanitizer{}, "embedded_0.3.1.sanitized.golden"},
+		{"html", HTML, AllowlistSanitizer{}, "embedded_0.3.1.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", tt.format.String(), tt.wantFile)
+			r, err := os.Open(filepath.Join("testdata", "embedded_0.3.1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithFormat(tt.format).WithMarkdownEngine(engine)
+			if tt.sanitizer != nil {
+				md = md.WithSanitizer(tt.sanitizer)
+			}
+
+			render(t, md, w, wantFile)
+		})
+	}
+
+	t.Run("no engine", func(t *testing.T) {
+		r, err := os.Open(filepath.Join("testdata", "embedded_0.3.1.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		md := NewMobiledoc(r).WithFormat(HTML)
+		if err := md.Render(ioutil.Discard); err == nil {
+			t.Error("Render() error = nil, want an error for the markdown card")
+		}
+	})
+}
+
+func TestRender_sanitized(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		hugo     bool
+		wantFile string
+	}{
+		{"html", HTML, false, "hostile_0.3.2.golden"},
+		{"markdown", Markdown, false, "hostile_0.3.2.golden"},
+		{"hugo", Markdown, true, "hostile_0.3.2.hugo.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", tt.format.String(), tt.wantFile)
+			r, err := os.Open(filepath.Join("testdata", "hostile_0.3.2.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithFormat(tt.format).WithSanitizer(nil)
+			if tt.hugo {
+				md = md.WithHugo(HugoShortcodes{})
+			} else {
+				// only Hugo renders embeds and callouts natively
+				empty := func(interface{}) string { return "" }
+				md = md.WithCard("embed", empty).WithCard("callout", empty)
+			}
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestAllowlistSanitizer(t *testing.T) {
+	tests := []struct {
+		name     string
+		elements map[string][]string
+		in, want string
+	}{
+		{"text", nil, "a < b & c > d", "a &lt; b & c > d"},
+		{"script", nil, "<p>a<script>alert('</p>')</script>b</p>", "<p>ab</p>"},
+		{"unclosed script", nil, "<p>a<SCRIPT>alert(1)", "<p>a</p>"},
+		{"handlers", nil, `<img src="/a.png" onerror="alert(1)" alt='a "b"'>`,
+			`<img src="/a.png" alt="a &#34;b&#34;">`},
+		{"javascript url", nil, `<a href="  Java&#x09;Script:alert(1)">x</a>`, `<a>x</a>`},
+		{"safe urls", nil,
+			`<a href="https://example.com/a:b">x</a><a href="./a:b">y</a><a href="mailto:a@b.c">z</a>`,
+			`<a href="https://example.com/a:b">x</a><a href="./a:b">y</a><a href="mailto:a@b.c">z</a>`},
+		{"unknown elements", nil, "<iframe src=x>in</iframe><blink>on</blink><!-- c -->",
+			"on"},
+		{"unbalanced", nil, "<div><p><em>a</div>b</p></em>", "<div><p><em>a</em></p></div>b"},
+		{"unquoted", nil, "<td colspan=2 rowspan = '3' class=x>", `<td colspan="2" rowspan="3" class="x"></td>`},
+		{"cut short", nil, `<p>a<a href="x`, "<p>a</p>"},
+		{"allowlist", map[string][]string{"b": {"style"}}, `<b style="color: red" class="x">a</b><i>b</i>`,
+			`<b style="color: red">a</b>b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AllowlistSanitizer{Elements: tt.elements}.Sanitize(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender_transformError(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "transform_0.3.1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFailed := fmt.Errorf("failed")
+	md := NewMobiledoc(r).WithTransform(func(d *Document) error {
+		return errFailed
+	})
+	if err := md.Render(ioutil.Discard); !errors.Is(err, errFailed) {
+		t.Errorf("Render() error = %v, want %v", err, errFailed)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	want := []LinkRef{
+		{URL: "/old-slug/", Kind: AnchorLink, Section: 0, Text: "the old post"},
+		{URL: "https://example.com", Kind: AnchorLink, Section: 1, Text: "external"},
+		{URL: "/content/images/section.png", Kind: ImageLink, Section: 2},
+		{URL: "/content/images/photo.jpg", Kind: CardLink, Section: 3,
+			Card: "image", Key: "src"},
+		{URL: "/ghost/old-slug/", Kind: CardLink, Section: 3,
+			Card: "image", Key: "href"},
+		{URL: "https://example.com/article", Kind: CardLink, Section: 4,
+			Card: "bookmark", Key: "url"},
+		{URL: "https://www.youtube.com/watch?v=abc", Kind: CardLink, Section: 5,
+			Card: "embed", Key: "url"},
+	}
+	got := Links(parseFile(t, "links_0.3.1"))
+	if len(got) != len(want) {
+		t.Fatalf("Links() returned %d links, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Links()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRender_rewriteLinks(t *testing.T) {
+	w := &bytes.Buffer{}
+	wantFile := filepath.Join("testdata", "json", "links_0.3.1.rewrite.json")
+	r, err := os.Open(filepath.Join("testdata", "links_0.3.1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMobiledoc(r).
+		WithFormat(JSON).
+		WithTransform(RewriteLinks(func(l LinkRef) (string, error) {
+			if strings.HasPrefix(l.URL, "/ghost/") {
+				return strings.TrimPrefix(l.URL, "/ghost"), nil
+			}
+			if strings.HasPrefix(l.URL, "/") && l.Kind == AnchorLink {
+				return "/posts" + l.URL, nil
+			}
+			return l.URL, nil
+		}))
+
+	render(t, md, w, wantFile)
+}
+
+func TestAssets(t *testing.T) {
+	const host = "https://blog.example.com/content/"
+	want := []Asset{
+		{URL: host + "images/header.png", Section: 0},
+		{URL: host + "images/2020/photo.jpg", Section: 1, Card: "image", Key: "src"},
+		{URL: host + "images/2019/photo.jpg", Section: 2, Card: "gallery",
+			Key: "images[0].src"},
+		{URL: host + "images/2020/photo.jpg", Section: 2, Card: "gallery",
+			Key: "images[1].src"},
+		{URL: host + "media/clip.mp4", Section: 3, Card: "video", Key: "src"},
+		{URL: host + "images/clip.png", Section: 3, Card: "video",
+			Key: "thumbnailSrc"},
+	}
+	got := Assets(parseFile(t, "assets_0.3.1"))
+	if len(got) != len(want) {
+		t.Fatalf("Assets() returned %d assets, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Assets()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRender_localize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mobiledoc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var fetched []string
+	fetcher := FetcherFunc(func(url string) (io.ReadCloser, error) {
+		fetched = append(fetched, url)
+		return ioutil.NopCloser(strings.NewReader(url)), nil
+	})
+
+	w := &bytes.Buffer{}
+	wantFile := filepath.Join("testdata", "json", "assets_0.3.1.localize.json")
+	r, err := os.Open(filepath.Join("testdata", "assets_0.3.1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMobiledoc(r).
+		WithFormat(JSON).
+		WithTransform(Localize(fetcher, dir, "/images"))
+
+	render(t, md, w, wantFile)
+
+	if len(fetched) != 5 {
+		t.Errorf("fetched %d assets, want 5: %v", len(fetched), fetched)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "photo-1.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://blog.example.com/content/images/2019/photo.jpg"; string(b) != want {
+		t.Errorf("photo-1.jpg = %q, want %q", b, want)
+	}
+}
+
+func TestAssetName(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://example.com/images/photo.jpg", "photo.jpg"},
+		{"https://example.com/", "asset"},
+		{"https://example.com/images/..", "asset"},
+		{"https://example.com/%2e%2e", "asset"},
+		{"https://example.com/..%5c..%5cphoto.jpg", "asset"},
+	}
+	for _, tt := range tests {
+		if got := assetName(tt.url); got != tt.want {
+			t.Errorf("assetName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestAssetURL(t *testing.T) {
+	tests := []struct {
+		prefix, name, want string
+	}{
+		{"/images", "photo.jpg", "/images/photo.jpg"},
+		{"https://cdn.example.com/images/", "photo.jpg", "https://cdn.example.com/images/photo.jpg"},
+		{"", "my photo.jpg", "my%20photo.jpg"},
+	}
+	for _, tt := range tests {
+		if got := assetURL(tt.prefix, tt.name); got != tt.want {
+			t.Errorf("assetURL(%q, %q) = %q, want %q", tt.prefix, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDirFetcher(t *testing.T) {
+	r, err := DirFetcher("testdata").Fetch("https://example.com/empty_0.3.2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "empty_0.3.2.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("Fetch() = %q, want %q", b, want)
+	}
+
+	_, err = DirFetcher("testdata").Fetch("https://example.com/../mobiledoc.go")
+	if err == nil {
+		t.Error("Fetch() outside of the directory error = nil, want error")
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Getting Started", "getting-started"},
+		{"On Linux & macOS", "on-linux-macos"},
+		{"  snake_case -- words ", "snake_case-words"},
+		{"Café 日本", "café-日本"},
+		{"!!!", "section"},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.text); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	var trace func(headings []*Heading) string
+	trace = func(headings []*Heading) string {
+		var parts []string
+		for _, h := range headings {
+			part := fmt.Sprintf("h%d#%s@%d", h.Level, h.ID, h.Section)
+			if len(h.Children) > 0 {
+				part += "(" + trace(h.Children) + ")"
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	d := parseFile(t, "toc_0.3.2")
+	want := "h1#getting-started@0(h2#install-quickly@2(h3#on-linux-macos@3) " +
+		"h2#usage@4 h2#usage-1@5(h6#notes@6))"
+	if got := trace(Headings(d, nil)); got != want {
+		t.Errorf("Headings() = %s, want %s", got, want)
+	}
+
+	upper := func(text string) string { return strings.ToUpper(text[:1]) }
+	want = "h1#G@0(h2#I@2(h3#O@3) h2#U@4 h2#U-1@5(h6#N@6))"
+	if got := trace(Headings(d, upper)); got != want {
+		t.Errorf("Headings() with slug = %s, want %s", got, want)
+	}
+}
+
+func TestRenderTOC(t *testing.T) {
+	tests := []struct {
+		format Format
+		ext    string
+	}{
+		{Markdown, ".md"},
+		{HTML, ".html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			w := &bytes.Buffer{}
+			err := RenderTOC(w, Headings(parseFile(t, "toc_0.3.2"), nil), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantFile := filepath.Join("testdata", "toc", "toc_0.3.2"+tt.ext)
+			compareGolden(t, w.Bytes(), wantFile)
+		})
+	}
+
+	if err := RenderTOC(ioutil.Discard, nil, LaTeX); err == nil {
+		t.Error("RenderTOC() to LaTeX error = nil, want error")
+	}
+}
+
+func TestRender_headingIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		mode   AttributeMode
+	}{
+		{"toc_0.3.2.ids.golden", Markdown, DropAttributes},
+		{"toc_0.3.2.ids.attribute_lists.golden", Markdown, AttributeLists},
+		{"toc_0.3.2.ids.golden", HTML, DropAttributes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String()+"/"+tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", tt.format.String(), tt.name)
+			r, err := os.Open(filepath.Join("testdata", "toc_0.3.2.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).
+				WithFormat(tt.format).
+				WithAttributeMode(tt.mode).
+				WithHeadingIDs(nil)
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
 
-	if updateFlag {
-		var f *os.File
-		f, err = os.Create(wantFile)
-		if err != nil {
-			t.Fatalf("os.Create() err = %s; want nil", err)
+func TestStatistics(t *testing.T) {
+	d := parseFile(t, "stats_0.3.1")
+	got := Statistics(d, StatsOptions{})
+	want := Stats{
+		Words:      11,
+		Characters: 41,
+		Images:     4,
+		Headings:   1,
+		Cards:      map[string]int{"image": 1, "gallery": 1, "code": 1},
+		Atoms:      map[string]int{"mention": 1},
+		// 11 words at 275 per minute and images of 12, 11, 10 and 9 seconds
+		ReadingTime: 44400 * time.Millisecond,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Statistics() = %+v, want %+v", got, want)
+	}
+	if got.ReadingMinutes() != 1 {
+		t.Errorf("ReadingMinutes() = %d, want 1", got.ReadingMinutes())
+	}
+
+	got = Statistics(d, StatsOptions{
+		WordsPerMinute: 11, ImageSeconds: 30, MinImageSeconds: 29,
+	})
+	if want := 60*time.Second + 30*time.Second + 29*3*time.Second; got.ReadingTime != want {
+		t.Errorf("Statistics() reading time = %s, want %s", got.ReadingTime, want)
+	}
+	if got.ReadingMinutes() != 3 {
+		t.Errorf("ReadingMinutes() = %d, want 3", got.ReadingMinutes())
+	}
+}
+
+func TestRender_excerpt(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ExcerptOptions
+	}{
+		{"words_4", ExcerptOptions{Words: 4, Ellipsis: "…"}},
+		{"words_5", ExcerptOptions{Words: 5, Cards: true}},
+		{"words_9", ExcerptOptions{Words: 9, Ellipsis: "…"}},
+		{"characters_15", ExcerptOptions{Characters: 15, Ellipsis: "…"}},
+		{"unlimited", ExcerptOptions{}},
+	}
+	for _, tt := range tests {
+		for _, format := range []Format{Markdown, HTML} {
+			t.Run(tt.name+"/"+format.String(), func(t *testing.T) {
+				w := &bytes.Buffer{}
+				wantFile := filepath.Join(
+					"testdata", format.String(),
+					"excerpt_0.3.1."+tt.name+".golden",
+				)
+				r, err := os.Open(filepath.Join("testdata", "excerpt_0.3.1.json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				md := NewMobiledoc(r).
+					WithFormat(format).
+					WithTransform(Excerpt(tt.opts))
+
+				render(t, md, w, wantFile)
+			})
 		}
-		f.Write(w.Bytes())
-		f.Close()
 	}
+}
 
-	f, err := os.Open(wantFile)
-	if err != nil {
-		t.Fatalf("os.Open() err = %s; want nil", err)
+func TestPlainText(t *testing.T) {
+	d := parseFile(t, "excerpt_0.3.1")
+	if err := Excerpt(ExcerptOptions{Words: 7, Ellipsis: "..."})(d); err != nil {
+		t.Fatal(err)
 	}
-	want, err := ioutil.ReadAll(f)
-	f.Close()
-	if err != nil {
-		t.Fatalf("ioutil.ReadAll() err = %s; want nil", err)
+	want := "A title\n\nSome bold linked text, and..."
+	if got := PlainText(d); got != want {
+		t.Errorf("PlainText() = %q, want %q", got, want)
 	}
 
-	if gotW := w.Bytes(); !bytes.Equal(gotW, want) {
-		t.Errorf("Render() = %q, want %q", gotW, want)
+	want = "first item\nsecond item\nnested item\nanother nested item\n" +
+		"deeply nested item\nthird item\n\nBetween lists\n\ntop\nskipped level"
+	if got := PlainText(parseFile(t, "nested_list_0.3.2")); got != want {
+		t.Errorf("PlainText() = %q, want %q", got, want)
 	}
 }
 
-func TestRender(t *testing.T) {
+func TestDiff(t *testing.T) {
+	diffs := Diff(parseFile(t, "diff_from_0.3.1"), parseFile(t, "diff_to_0.3.1"))
+	var kinds []string
+	for _, d := range diffs {
+		kinds = append(kinds, d.Kind.String())
+	}
+	want := "equal modified removed modified removed inserted inserted equal"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Errorf("Diff() kinds = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		render func(io.Writer, []SectionDiff) error
+	}{
+		{"diff.txt", RenderUnifiedDiff},
+		{"diff.html", RenderHTMLDiff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if err := tt.render(w, diffs); err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, w.Bytes(), filepath.Join("testdata", "diff", tt.name))
+		})
+	}
+}
+
+func TestDiff_equal(t *testing.T) {
+	d := parseFile(t, "nested_list_0.3.2")
+	for _, diff := range Diff(d, parseFile(t, "nested_list_0.3.2")) {
+		if diff.Kind != Equal {
+			t.Errorf("Diff() of equal documents has %s section", diff.Kind)
+		}
+	}
+}
+
+func TestMarshalMobiledoc(t *testing.T) {
 	tests := []string{
-		"empty_0.3.0",
-		"empty_0.3.1",
 		"empty_0.3.2",
-		"image_section_0.3.0",
-		"image_section_0.3.1",
-		"without_markup_0.3.0",
-		"without_markup_0.3.1",
-		"simple_markup_0.3.0",
-		"simple_markup_0.3.1",
-		"attribute_markup_0.3.0",
-		"attribute_markup_0.3.1",
 		"multi_marker_section_0.3.1",
-		"list_section_0.3.1",
-		"image_card_0.3.1",
-		"section_attributes_0.3.2",
+		"attribute_markup_0.3.1",
+		"atom_0.3.1",
+		"nested_list_0.3.2",
+		"aligned_sections_0.3.2",
+		"link_attributes_0.3.2",
+		"formats_0.3.2",
+		"ghost_the-editor",
 	}
 	for _, tt := range tests {
 		t.Run(tt, func(t *testing.T) {
+			d := parseFile(t, tt)
+			src, err := d.MarshalMobiledoc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(bytes.NewReader(src))
+			got, err := md.Parse()
+			if err != nil {
+				t.Fatalf("Parse() error = %v, want nil\n%s", err, src)
+			}
+
+			// only the Mobiledoc version may differ
+			got.Version = d.Version
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(d)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("Parse() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestMarshalMobiledoc_adjacentLists(t *testing.T) {
+	d := NewBuilder().
+		List(false,
+			Item(Text("first")).
+				Nest(true, Item(Text("nested"))).
+				Nest(true, Item(Text("second nested"))),
+		).
+		List(false, Item(Text("second"))).
+		Document()
+
+	src, err := d.MarshalMobiledoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMobiledoc(bytes.NewReader(src))
+	got, err := md.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v, want nil\n%s", err, src)
+	}
+	got.Version = d.Version
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(d)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("Parse() = %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder().
+		Heading(2, "Release 1.2").
+		Paragraph(
+			Text("This release is "),
+			NewMarkup(STRONG, nil, Text("much "), Italic("faster")),
+			Text(", see "),
+			Link("the notes", "https://example.com/notes"),
+			Text(" or ask "),
+			NewAtom("mention", "maintainers", nil),
+			Text("."),
+		).
+		List(false,
+			Item(Text("Parser "), Code("Parse()")),
+			Item(Text("Renderers")).Nest(true,
+				Item(Bold("Markdown")),
+				Item(Text("HTML")),
+			),
+			Item(Text("Builder")),
+		).
+		Quote(Text("Thanks to everyone.")).
+		Image("https://example.com/chart.png").
+		Card("code", map[string]interface{}{"code": "go get ./..."})
+
+	src, err := b.Document().MarshalMobiledoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, src, "", "\t"); err != nil {
+		t.Fatal(err)
+	}
+	indented.WriteString("\n")
+	compareGolden(t, indented.Bytes(), filepath.Join("testdata", "builder_0.3.2.json"))
+
+	for _, format := range []Format{Markdown, HTML} {
+		t.Run(format.String(), func(t *testing.T) {
+			md, err := b.Mobiledoc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			md = md.
+				WithFormat(format).
+				WithAtom("mention", func(value string, payload interface{}) string {
+					return "@" + value
+				}).
+				WithCard("code", func(payload interface{}) string {
+					return "go get ./..."
+				})
+
 			w := &bytes.Buffer{}
-			wantFile := filepath.Join("testdata", "markdown", tt+".golden")
+			render(t, md, w, filepath.Join("testdata", format.String(), "builder_0.3.2.golden"))
+		})
+	}
+}
+
+func TestRender_hugo(t *testing.T) {
+	tests := []struct {
+		name       string
+		shortcodes HugoShortcodes
+	}{
+		{"hugo_0.3.1", HugoShortcodes{}},
+		{"hugo_0.3.1.custom", HugoShortcodes{
+			Gallery: "image-gallery",
+			Callout: "notice",
+		}},
+		{"hugo_0.3.1.templates", HugoShortcodes{
+			Templates: map[string]Template{
+				"image": texttemplate.Must(texttemplate.New("image").Parse(
+					`{{"{{"}}< img src="{{.Payload.src}}" >{{"}}"}}`,
+				)),
+				"code": texttemplate.Must(texttemplate.New("code").Parse(
+					"{{`{{`}}< code >{{`}}`}}{{.Payload.code}}{{`{{`}}< /code >{{`}}`}}",
+				)),
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", "markdown", tt.name+".golden")
+			r, err := os.Open(filepath.Join("testdata", "hugo_0.3.1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).WithHugo(tt.shortcodes)
+
+			render(t, md, w, wantFile)
+		})
+	}
+}
+
+func TestShortcodeArg(t *testing.T) {
+	tests := []struct {
+		v, want string
+	}{
+		{"plain", `"plain"`},
+		{`The "old" harbour`, `"The \"old\" harbour"`},
+		{"a `raw` \"quoted\" value", "\"a `raw` \\\"quoted\\\" value\""},
+	}
+	for _, tt := range tests {
+		if got := shortcodeArg(tt.v); got != tt.want {
+			t.Errorf("shortcodeArg(%q) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestRender_templates(t *testing.T) {
+	markdown, err := ParseTextTemplates("testdata/templates/markdown/*.tmpl")
+	if err != nil {
+		t.Fatalf("ParseTextTemplates() err = %v, want nil", err)
+	}
+	html, err := ParseHTMLTemplates("testdata/templates/html/*.html")
+	if err != nil {
+		t.Fatalf("ParseHTMLTemplates() err = %v, want nil", err)
+	}
+
+	tests := []struct {
+		format    Format
+		templates map[string]Template
+		wantFile  string
+	}{
+		{Markdown, markdown, "testdata/markdown/template_0.3.1.golden"},
+		{HTML, html, "testdata/html/template_0.3.1.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			r, err := os.Open(filepath.Join("testdata", "template_0.3.1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := NewMobiledoc(r).
+				WithFormat(tt.format).
+				WithFormatAtomTemplate(tt.format, "mention", tt.templates["mention"]).
+				WithCardTemplate("quote-card", tt.templates["quote-card"])
+
+			w := &bytes.Buffer{}
+			render(t, md, w, tt.wantFile)
+		})
+	}
+}
+
+func TestRender_templateError(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "template_0.3.1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	atom := texttemplate.Must(texttemplate.New("mention").Parse("{{.Value}}"))
+	card := texttemplate.Must(texttemplate.New("quote-card").Parse("{{.Missing}}"))
+	md := NewMobiledoc(r).
+		WithAtomTemplate("mention", atom).
+		WithCardTemplate("quote-card", card)
+
+	if err = md.Render(&bytes.Buffer{}); err == nil {
+		t.Errorf("Render() error = %v, wantErr true", err)
+	}
+}
+
+func TestParseTextTemplates_noMatch(t *testing.T) {
+	if _, err := ParseTextTemplates("testdata/templates/*.missing"); err == nil {
+		t.Errorf("ParseTextTemplates() error = %v, wantErr true", err)
+	}
+}
+
+func TestRender_formatCard(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "image_card_0.3.1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := NewMobiledoc(r).
+		WithCard("image-card", func(payload interface{}) string {
+			return "generic"
+		}).
+		WithFormatCard(HTML, "image-card", func(payload interface{}) string {
+			return "<hr>"
+		})
+
+	w := &bytes.Buffer{}
+	if err = md.Render(w); err != nil {
+		t.Fatalf("Render() error = %v, want nil", err)
+	}
+	if got, want := w.String(), "generic\n\n"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	w.Reset()
+	md = md.WithFormat(HTML)
+	if err = md.Render(w); err != nil {
+		t.Fatalf("Render() error = %v, want nil", err)
+	}
+	if got, want := w.String(), "<hr>\n"; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+// renderFormat renders the named test documents to format, comparing the
+// result with the golden files in testdata/<format>.
+func renderFormat(t *testing.T, format Format, ext string, tests []string) {
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			wantFile := filepath.Join("testdata", format.String(), tt+ext)
 			r, err := os.Open(filepath.Join("testdata", tt+".json"))
 			if err != nil {
 				t.Fatal(err)
 			}
-			md := NewMobiledoc(r)
+			md := NewMobiledoc(r).
+				WithFormat(format).
+				WithAtom("mention", func(value string, payload interface{}) string {
+					return "@" + value
+				})
 
 			render(t, md, w, wantFile)
 		})
 	}
 }
 
+func TestRender_asciidoc(t *testing.T) {
+	renderFormat(t, AsciiDoc, ".adoc", []string{
+		"empty_0.3.2",
+		"multi_marker_section_0.3.1",
+		"attribute_markup_0.3.1",
+		"nested_list_0.3.2",
+		"link_attributes_0.3.2",
+		"formats_0.3.2",
+		"special_characters_0.3.2",
+		"hostile_markup_0.3.2",
+		"blocks_0.3.2",
+		"adjacent_lists_0.3.2",
+		"asciidoc_titles_0.3.2",
+	})
+}
+
+func TestRender_rst(t *testing.T) {
+	renderFormat(t, RST, ".rst", []string{
+		"empty_0.3.2",
+		"multi_marker_section_0.3.1",
+		"attribute_markup_0.3.1",
+		"nested_list_0.3.2",
+		"link_attributes_0.3.2",
+		"formats_0.3.2",
+		"rst_inline_0.3.1",
+		"hostile_markup_0.3.2",
+		"rst_line_starts_0.3.1",
+	})
+}
+
+func TestRender_org(t *testing.T) {
+	renderFormat(t, Org, ".org", []string{
+		"empty_0.3.2",
+		"multi_marker_section_0.3.1",
+		"attribute_markup_0.3.1",
+		"nested_list_0.3.2",
+		"link_attributes_0.3.2",
+		"formats_0.3.2",
+		"special_characters_0.3.2",
+		"blocks_0.3.2",
+	})
+}
+
+func TestRender_gemtext(t *testing.T) {
+	renderFormat(t, Gemtext, ".gmi", []string{
+		"empty_0.3.2",
+		"multi_marker_section_0.3.1",
+		"attribute_markup_0.3.1",
+		"nested_list_0.3.2",
+		"link_attributes_0.3.2",
+		"formats_0.3.2",
+		"special_characters_0.3.2",
+	})
+}
+
+func TestRender_latex(t *testing.T) {
+	renderFormat(t, LaTeX, ".tex", []string{
+		"empty_0.3.2",
+		"multi_marker_section_0.3.1",
+		"attribute_markup_0.3.1",
+		"nested_list_0.3.2",
+		"link_attributes_0.3.2",
+		"formats_0.3.2",
+		"special_characters_0.3.2",
+		"blocks_0.3.2",
+	})
+}
+
+func TestRender_json(t *testing.T) {
+	renderFormat(t, JSON, ".json", []string{
+		"empty_0.3.2",
+		"multi_marker_section_0.3.1",
+		"attribute_markup_0.3.1",
+		"atom_0.3.1",
+		"nested_list_0.3.2",
+		"image_card_0.3.1",
+		"formats_0.3.2",
+	})
+}
+
+func TestRSTWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"Changes", 7},
+		{"Café", 4},
+		{"日本語のタイトル", 16},
+	}
+	for _, tt := range tests {
+		if got := rstWidth(tt.s); got != tt.want {
+			t.Errorf("rstWidth(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
 func TestRender_WithAtom(t *testing.T) {
 	tt := "atom_0.3.1"
 	w := &bytes.Buffer{}
@@ -257,3 +1455,123 @@ func TestRenderMarkdown_errors(t *testing.T) {
 		})
 	}
 }
+
+func parseFile(t *testing.T, name string) *Document {
+	t.Helper()
+	r, err := os.Open(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	md := NewMobiledoc(r)
+	d, err := md.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// traceVisitor records the elements entered and left, returning the error
+// for the elements in errs
+type traceVisitor struct {
+	trace []string
+	errs  map[string]error
+}
+
+func (v *traceVisitor) name(e Element) string {
+	switch e := e.(type) {
+	case *MarkupSection:
+		return e.Tag
+	case *ListSection:
+		return e.Tag
+	case *ListItem:
+		return "li"
+	case *Markup:
+		return e.Tag
+	case *TextNode:
+		return fmt.Sprintf("%q", e.Value)
+	case *AtomNode:
+		return "atom:" + e.Name
+	case *CardSection:
+		return "card:" + e.Name
+	case *ImageSection:
+		return "img"
+	}
+	return "?"
+}
+
+func (v *traceVisitor) Enter(e Element) error {
+	name := v.name(e)
+	v.trace = append(v.trace, "<"+name)
+	return v.errs["<"+name]
+}
+
+func (v *traceVisitor) Leave(e Element) error {
+	name := v.name(e)
+	v.trace = append(v.trace, name+">")
+	return v.errs[name+">"]
+}
+
+func TestWalk(t *testing.T) {
+	errFailed := fmt.Errorf("failed")
+	tests := []struct {
+		name    string
+		file    string
+		errs    map[string]error
+		want    string
+		wantErr error
+	}{
+		{
+			name: "markups",
+			file: "multi_marker_section_0.3.1",
+			want: `<p <b <"hello " "hello "> <i <"brave " "brave "> ` +
+				`<"new " "new "> i> <"world" "world"> b> p>`,
+		},
+		{
+			name: "atom",
+			file: "atom_0.3.1",
+			want: `<p <atom:hello-atom atom:hello-atom> p>`,
+		},
+		{
+			name: "skip children",
+			file: "multi_marker_section_0.3.1",
+			errs: map[string]error{"<i": SkipChildren},
+			want: `<p <b <"hello " "hello "> <i i> <"world" "world"> b> p>`,
+		},
+		{
+			name: "stop",
+			file: "multi_marker_section_0.3.1",
+			errs: map[string]error{`<"brave "`: Stop},
+			want: `<p <b <"hello " "hello "> <i <"brave "`,
+		},
+		{
+			name: "error",
+			file: "multi_marker_section_0.3.1",
+			errs: map[string]error{"i>": errFailed},
+			want: `<p <b <"hello " "hello "> <i <"brave " "brave "> ` +
+				`<"new " "new "> i>`,
+			wantErr: errFailed,
+		},
+		{
+			name: "nested list",
+			file: "nested_list_0.3.2",
+			errs: map[string]error{"<ul": SkipChildren},
+			want: `<ol <li <"first item" "first item"> li> ` +
+				`<li <"second item" "second item"> <ul ul> li> ` +
+				`<li <"third item" "third item"> li> ol> ` +
+				`<p <"Between lists" "Between lists"> p> <ul ul>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &traceVisitor{errs: tt.errs}
+			err := Walk(parseFile(t, tt.file), v)
+			if err != tt.wantErr {
+				t.Errorf("Walk() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := strings.Join(v.trace, " "); got != tt.want {
+				t.Errorf("Walk() visited\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
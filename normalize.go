@@ -0,0 +1,85 @@
+package mobiledoc
+
+// Normalize is a Transform that cleans up the artifacts left by editors, so
+// that documents with the same content have the same structure. It removes
+// empty text and markups without content, joins adjacent text and adjacent
+// markups with the same tag and attributes, unwraps markups nested within
+// themselves, trims the whitespace and line breaks at the end of sections
+// and list items and removes blank paragraphs.
+func Normalize(d *Document) error {
+	err := Walk(d, VisitorFuncs{EnterFunc: func(e Element) error {
+		switch e := e.(type) {
+		case *MarkupSection:
+			e.Children = trimTrailingSpace(normalizeInlines(e.Children, nil))
+		case *ListItem:
+			e.Children = trimTrailingSpace(normalizeInlines(e.Children, nil))
+		case *Markup, *TextNode, *AtomNode:
+			return SkipChildren
+		}
+		return nil
+	}})
+	if err != nil {
+		return err
+	}
+	return StripEmptyParagraphs(d)
+}
+
+// normalizeInlines returns inlines normalized within the markups open.
+func normalizeInlines(inlines []Inline, open []*Markup) []Inline {
+	var normalized []Inline
+	add := func(i Inline) {
+		if len(normalized) == 0 {
+			normalized = append(normalized, i)
+			return
+		}
+		switch prev := normalized[len(normalized)-1].(type) {
+		case *TextNode:
+			if t, ok := i.(*TextNode); ok {
+				prev.Value += t.Value
+				return
+			}
+		case *Markup:
+			if m, ok := i.(*Markup); ok && sameMarkup(prev, m) {
+				prev.Children = normalizeInlines(
+					append(prev.Children, m.Children...), append(open, prev),
+				)
+				return
+			}
+		}
+		normalized = append(normalized, i)
+	}
+
+	for _, i := range inlines {
+		switch i := i.(type) {
+		case *TextNode:
+			if i.Value != "" {
+				add(i)
+			}
+		case *Markup:
+			children := normalizeInlines(i.Children, append(open, i))
+			if isOpen(i, open) {
+				for _, c := range children {
+					add(c)
+				}
+				continue
+			}
+			if len(children) > 0 {
+				i.Children = children
+				add(i)
+			}
+		default:
+			add(i)
+		}
+	}
+	return normalized
+}
+
+// isOpen reports whether a markup the same as m is among the open markups.
+func isOpen(m *Markup, open []*Markup) bool {
+	for _, o := range open {
+		if sameMarkup(o, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package mobiledoc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// orgMarkers maps inline markups to the strings surrounding them in Org
+var orgMarkers = map[string][2]string{
+	BOLD:          {"*", "*"},
+	STRONG:        {"*", "*"},
+	ITALIC:        {"/", "/"},
+	EMPHASIS:      {"/", "/"},
+	CODE:          {"~", "~"},
+	UNDERLINE:     {"_", "_"},
+	STRIKETHROUGH: {"+", "+"},
+	SUBSCRIPT:     {"_{", "}"},
+	SUPERSCRIPT:   {"^{", "}"},
+}
+
+// orgZeroWidthSpace is inserted next to the characters that would otherwise
+// start markup, as Org has no escape character
+const orgZeroWidthSpace = "\u200b"
+
+// orgEscaper separates emphasis, link, snippet and macro markers from the
+// text before them, so they can not open markup, and sub and superscript
+// markers from both sides
+var orgEscaper = func() *strings.Replacer {
+	var pairs []string
+	for _, c := range []string{"*", "/", "=", "~", "+", "[", "@", "{"} {
+		pairs = append(pairs, c, orgZeroWidthSpace+c)
+	}
+	for _, c := range []string{"_", "^"} {
+		pairs = append(pairs, c, orgZeroWidthSpace+c+orgZeroWidthSpace)
+	}
+	return strings.NewReplacer(pairs...)
+}()
+
+// orgText escapes the text n, including its first character when it would
+// start a heading, list, table, keyword or fixed width line.
+func (n *node) orgText() string {
+	s := orgEscaper.Replace(n.value)
+	if n.startsLine() && s != "" &&
+		(strings.ContainsRune("#-|:", rune(s[0])) || (s[0] >= '0' && s[0] <= '9')) {
+		s = orgZeroWidthSpace + s
+	}
+	return s
+}
+
+// orgPre reports whether emphasis may open after r, the character before it
+// or 0 at the start of the text.
+func orgPre(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) || strings.ContainsRune(`-('"{`, r)
+}
+
+// orgPost reports whether emphasis may close before r, the character after
+// it or 0 at the end of the text.
+func orgPost(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) || strings.ContainsRune(`-.,;:!?')"}[\`, r)
+}
+
+// precedingRune returns the last character before n within its section.
+func (n *node) precedingRune() rune {
+	for p := n; p != nil && p.parent != nil; p = p.parent {
+		if p.isMarkupSection() || strings.ToLower(p.tagname) == LISTITEM {
+			break
+		}
+		for s := p.prevSibling; s != nil; s = s.prevSibling {
+			if t := s.text(); t != "" {
+				r, _ := utf8.DecodeLastRuneInString(t)
+				return r
+			}
+		}
+	}
+	return 0
+}
+
+// orgCards are the cards rendered natively to Org, unless replaced by a
+// registered card of the same name
+var orgCards = map[string]Card{
+	"code": orgCodeCard,
+}
+
+func orgCodeCard(payload interface{}) string {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, _ := payloadString(m, "code")
+
+	var b strings.Builder
+	if caption, ok := payloadString(m, "caption"); ok {
+		fmt.Fprintf(&b, "#+CAPTION: %s\n", caption)
+	}
+	b.WriteString("#+BEGIN_SRC")
+	if language, ok := payloadString(m, "language"); ok {
+		fmt.Fprintf(&b, " %s", language)
+	}
+	// lines starting with * or #+ are escaped with a comma inside blocks
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "*") || strings.HasPrefix(trimmed, "#+") {
+			lines[i] = line[:len(line)-len(trimmed)] + "," + trimmed
+		}
+	}
+	fmt.Fprintf(&b, "\n%s\n#+END_SRC", strings.Join(lines, "\n"))
+	return b.String()
+}
+
+func (n *node) renderOrgImage(w io.Writer) error {
+	var err error
+	if caption, ok := n.attributes["caption"]; ok {
+		if _, err = fmt.Fprintf(w, "#+CAPTION: %s\n", caption); err != nil {
+			return err
+		}
+	}
+
+	var attributes []string
+	for _, k := range []string{"alt", "title", "width", "height"} {
+		if v, ok := n.attributes[k]; ok {
+			attributes = append(attributes, fmt.Sprintf(":%s %s", k, v))
+		}
+	}
+	if len(attributes) > 0 {
+		_, err = fmt.Fprintf(w, "#+ATTR_HTML: %s\n", strings.Join(attributes, " "))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "[[%s]]\n\n", n.attributes["src"])
+	return err
+}
+
+// renderOrgMarkup writes the inline markup n between its markers, keeping
+// surrounding whitespace outside of the markers as Org requires. Emphasis
+// within a word, which Org does not recognize, is written as HTML export
+// snippets instead, leaving plain text for other exports.
+func (n *node) renderOrgMarkup(w io.Writer, start, end string) error {
+	var b bytes.Buffer
+	if err := n.renderOrgContent(&b); err != nil {
+		return err
+	}
+
+	content := b.String()
+	core := strings.TrimSpace(content)
+	if core == "" {
+		_, err := fmt.Fprint(w, content)
+		return err
+	}
+	leading := content[:strings.Index(content, core)]
+	trailing := content[len(leading)+len(core):]
+	if start == end && ((leading == "" && !orgPre(n.precedingRune())) ||
+		(trailing == "" && !orgPost(n.followingRune()))) {
+		tag := n.htmlTagName()
+		start = "@@html:<" + tag + ">@@"
+		end = "@@html:</" + tag + ">@@"
+	}
+	_, err := fmt.Fprint(w, leading, start, core, end, trailing)
+	return err
+}
+
+func (n *node) renderOrgStart(w io.Writer) error {
+	var err error
+	tag := strings.ToLower(n.tagname)
+	switch tag {
+	case H1, H2, H3, H4, H5, H6:
+		level := int(tag[1] - '0')
+		_, err = fmt.Fprint(w, strings.Repeat("*", level), " ")
+	case LISTITEM:
+		marker := n.listMarker()
+		if marker == "* " {
+			marker = "- "
+		}
+		_, err = fmt.Fprint(w, n.orgListIndent(), marker)
+	case BLOCKQUOTE:
+		_, err = fmt.Fprint(w, "#+BEGIN_QUOTE\n")
+	case BREAK:
+		_, err = fmt.Fprint(w, n.lineBreak("\\\\\n"+n.orgListIndent()))
+	case PARAGRAPH:
+		if n.attributes[textAlignAttribute] == "center" && n.isMarkupSection() {
+			_, err = fmt.Fprint(w, "#+BEGIN_CENTER\n")
+		}
+	}
+	return err
+}
+
+func (n *node) renderOrgEnd(w io.Writer) error {
+	var err error
+	switch strings.ToLower(n.tagname) {
+	case LISTITEM:
+		// a nested list already ends the line
+		if !n.lastChild.isList() {
+			_, err = fmt.Fprint(w, "\n")
+		}
+	case ORDEREDLIST, UNORDEREDLIST:
+		if n.parent == nil || strings.ToLower(n.parent.tagname) != LISTITEM {
+			_, err = fmt.Fprint(w, "\n")
+		}
+	case BLOCKQUOTE:
+		_, err = fmt.Fprint(w, "\n#+END_QUOTE\n\n")
+	case PARAGRAPH:
+		if n.attributes[textAlignAttribute] == "center" && n.isMarkupSection() {
+			_, err = fmt.Fprint(w, "\n#+END_CENTER\n\n")
+		} else {
+			_, err = fmt.Fprint(w, "\n\n")
+		}
+	case H1, H2, H3, H4, H5, H6, ASIDE:
+		_, err = fmt.Fprint(w, "\n\n")
+	default:
+		// other sections are written as paragraphs
+		if n.parent != nil && n.parent.tagname == rootTag {
+			_, err = fmt.Fprint(w, "\n\n")
+		}
+	}
+	return err
+}
+
+// orgListIndent returns the indentation needed to nest an item under all
+// the list items containing n.
+func (n *node) orgListIndent() string {
+	var indent string
+	for p := n.parent; p != nil; p = p.parent {
+		if strings.ToLower(p.tagname) == LISTITEM {
+			// unordered items use "- " which is as wide as "* "
+			indent += strings.Repeat(" ", len(p.listMarker()))
+		}
+	}
+	return indent
+}
+
+func (n *node) renderOrgContent(w io.Writer) error {
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if c.isList() && strings.ToLower(n.tagname) == LISTITEM {
+			// nested lists start on their own line
+			if _, err := fmt.Fprint(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := c.renderOrg(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *node) renderOrg(w io.Writer) error {
+	var err error
+	tag := strings.ToLower(n.tagname)
+	switch tag {
+	case TEXT:
+		_, err = fmt.Fprint(w, n.orgText())
+		return err
+	case rawTag:
+		_, err = fmt.Fprint(w, n.value)
+		return err
+	case rootTag:
+		return n.renderOrgContent(w)
+	case cardTag:
+		_, err = fmt.Fprintf(w, "%s\n\n", strings.TrimRight(n.text(), "\n"))
+		return err
+	case IMAGE:
+		return n.renderOrgImage(w)
+	case ANCHOR:
+		var text bytes.Buffer
+		if err = n.renderOrgContent(&text); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "[[%s][%s]]", n.attributes["href"], text.String())
+		return err
+	}
+	if markers, ok := orgMarkers[tag]; ok {
+		return n.renderOrgMarkup(w, markers[0], markers[1])
+	}
+
+	if err = n.renderOrgStart(w); err != nil {
+		return err
+	}
+
+	if err = n.renderOrgContent(w); err != nil {
+		return err
+	}
+
+	return n.renderOrgEnd(w)
+}
@@ -3,6 +3,7 @@ package mobiledoc
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -39,31 +40,84 @@ func parseDoc(mdmap map[string]json.RawMessage) (doc, error) {
 	return d, nil
 }
 
-func (md *Mobiledoc) parseSectionImage(root *node, s []json.RawMessage) error {
+func (d *doc) parseSectionImage(
+	document *Document, s []json.RawMessage,
+) error {
 	var url string
 	err := json.Unmarshal(s[1], &url)
 	if err != nil {
 		return err
 	}
-	n := newNode(IMAGE, "")
-	n.addAttribute("src", url)
-	root.appendChild(n)
+	document.Sections = append(document.Sections, &ImageSection{Src: url})
 	return nil
 }
 
-func (md *Mobiledoc) parseSectionList(root *node, s []json.RawMessage) error {
+// Section attributes
+const (
+	// listLevelAttribute holds the nesting level of a list section, with 0
+	// being a top level list
+	listLevelAttribute = "data-md-list-level"
+	// listNewAttribute marks a list section starting a new list where it
+	// would otherwise resume the open list at its level
+	listNewAttribute = "data-md-list-new"
+	// textAlignAttribute holds the text alignment of a markup section
+	textAlignAttribute = "data-md-text-align"
+)
+
+// softReturnAtom is the atom Ghost uses for line breaks
+const softReturnAtom = "soft-return"
+
+// imageAttributes are the optional attributes of an image, other than src
+var imageAttributes = []string{
+	"alt", "title", "caption", "width", "height", "cardWidth",
+}
+
+func parseSectionAttributes(raw json.RawMessage) (map[string]string, error) {
+	var attributes []string
+	err := json.Unmarshal(raw, &attributes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal section attributes: %w", err)
+	}
+	if len(attributes)%2 != 0 {
+		return nil, errors.New("section attributes must be in pairs")
+	}
+
+	m := make(map[string]string)
+	for i := 0; i < len(attributes); i = i + 2 {
+		m[attributes[i]] = attributes[i+1]
+	}
+	return m, nil
+}
+
+// openLists returns the chain of lists still open at the end of the
+// document, the top level list first
+func (document *Document) openLists() []*ListSection {
+	var lists []*ListSection
+	if len(document.Sections) == 0 {
+		return nil
+	}
+	l, ok := document.Sections[len(document.Sections)-1].(*ListSection)
+	for ok {
+		lists = append(lists, l)
+		if len(l.Items) == 0 {
+			break
+		}
+		nested := l.Items[len(l.Items)-1].Lists
+		if len(nested) == 0 {
+			break
+		}
+		l = nested[len(nested)-1]
+	}
+	return lists
+}
+
+func (d *doc) parseSectionList(document *Document, s []json.RawMessage) error {
 	var tag string
 	err := json.Unmarshal(s[1], &tag)
 	if err != nil {
 		return err
 	}
-	switch strings.ToLower(tag) {
-	case UNORDEREDLIST, ORDEREDLIST:
-		// do nothing - valid
-	default:
-	}
-
-	n := newNode(tag, "")
+	tag = strings.ToLower(tag)
 
 	var items [][]json.RawMessage
 	err = json.Unmarshal(s[2], &items)
@@ -71,31 +125,76 @@ func (md *Mobiledoc) parseSectionList(root *node, s []json.RawMessage) error {
 		return err
 	}
 
-	for pos, markers := range items {
-		li := newNode(LISTITEM, "")
-		if strings.ToLower(tag) == ORDEREDLIST {
-			li.addAttribute("position", strconv.Itoa(pos+1))
+	level := 0
+	resume := true
+	var attributes map[string]string
+	if len(s) > 3 {
+		attributes, err = parseSectionAttributes(s[3])
+		if err != nil {
+			return err
+		}
+		if l, ok := attributes[listLevelAttribute]; ok {
+			level, err = strconv.Atoi(l)
+			if err != nil || level < 0 {
+				return fmt.Errorf("invalid list level %q", l)
+			}
+			// the level is kept as the nesting of the list
+			delete(attributes, listLevelAttribute)
+		}
+		if _, ok := attributes[listNewAttribute]; ok {
+			resume = false
+			delete(attributes, listNewAttribute)
+		}
+		if len(attributes) == 0 {
+			attributes = nil
 		}
+	}
 
-		err = md.addMarkersToNode(li, markers)
+	// A list can nest at most one level deeper than the lists already open,
+	// inside the last item of its parent list.
+	lists := document.openLists()
+	if level > len(lists) {
+		level = len(lists)
+	}
+
+	// A list resumes the open list at its level when a deeper list came
+	// between them, so that ordered lists keep their numbering, unless it is
+	// marked as a new list.
+	var list *ListSection
+	if resume && level < len(lists) && lists[level].Tag == tag &&
+		(level > 0 || len(lists) > 1) {
+		list = lists[level]
+	}
+	if list == nil {
+		list = &ListSection{Tag: tag, Attributes: attributes}
+		if level > 0 {
+			parent := lists[level-1].Items[len(lists[level-1].Items)-1]
+			parent.Lists = append(parent.Lists, list)
+		} else {
+			document.Sections = append(document.Sections, list)
+		}
+	}
+
+	for _, markers := range items {
+		children, err := d.parseMarkers(markers)
 		if err != nil {
 			return err
 		}
-
-		n.appendChild(li)
+		list.Items = append(list.Items, &ListItem{Children: children})
 	}
 
-	root.appendChild(n)
 	return nil
 }
 
-func (md *Mobiledoc) parseSectionMarkup(root *node, s []json.RawMessage) error {
+func (d *doc) parseSectionMarkup(
+	document *Document, s []json.RawMessage,
+) error {
 	var tag string
 	err := json.Unmarshal(s[1], &tag)
 	if err != nil {
 		return err
 	}
-	n := newNode(tag, "")
+	section := &MarkupSection{Tag: strings.ToLower(tag)}
 
 	var markers []json.RawMessage
 	err = json.Unmarshal(s[2], &markers)
@@ -103,31 +202,46 @@ func (md *Mobiledoc) parseSectionMarkup(root *node, s []json.RawMessage) error {
 		return err
 	}
 
-	err = md.addMarkersToNode(n, markers)
+	section.Children, err = d.parseMarkers(markers)
 	if err != nil {
 		return err
 	}
 
-	root.appendChild(n)
-	return err
+	if len(s) > 3 {
+		section.Attributes, err = parseSectionAttributes(s[3])
+		if err != nil {
+			return err
+		}
+		if len(section.Attributes) == 0 {
+			section.Attributes = nil
+		}
+	}
+
+	document.Sections = append(document.Sections, section)
+	return nil
 }
 
-func (md *Mobiledoc) parseSectionCard(root *node, s []json.RawMessage) error {
+func (d *doc) parseSectionCard(document *Document, s []json.RawMessage) error {
 	var cardIndex int
 	err := json.Unmarshal(s[1], &cardIndex)
 	if err != nil {
 		return err
 	}
-	card := md.doc.cards[cardIndex]
-	n, err := md.renderCard(&card)
-	if err != nil {
-		return err
+	if cardIndex < 0 || cardIndex >= len(d.cards) {
+		return fmt.Errorf("unknown card %d", cardIndex)
 	}
-	root.appendChild(n)
+	c := d.cards[cardIndex]
+	document.Sections = append(
+		document.Sections, &CardSection{Name: c.name, Payload: c.payload},
+	)
 	return nil
 }
 
-func (md *Mobiledoc) parseSection(root *node, s []json.RawMessage) error {
+func (d *doc) parseSection(document *Document, s []json.RawMessage) error {
+	if len(s) < 2 {
+		return errors.New("section too short")
+	}
+
 	var t int
 	err := json.Unmarshal(s[0], &t)
 	if err != nil {
@@ -136,92 +250,133 @@ func (md *Mobiledoc) parseSection(root *node, s []json.RawMessage) error {
 
 	switch t {
 	case sectionImage:
-		if err = md.parseSectionImage(root, s); err != nil {
-			return err
-		}
-
+		return d.parseSectionImage(document, s)
 	case sectionList:
-		if err = md.parseSectionList(root, s); err != nil {
-			return err
+		if len(s) < 3 {
+			return errors.New("list section too short")
 		}
-
+		return d.parseSectionList(document, s)
 	case sectionMarkup:
-		if err = md.parseSectionMarkup(root, s); err != nil {
-			return err
+		if len(s) < 3 {
+			return errors.New("markup section too short")
 		}
-
+		return d.parseSectionMarkup(document, s)
 	case sectionCard:
-		if err = md.parseSectionCard(root, s); err != nil {
-			return err
-		}
+		return d.parseSectionCard(document, s)
 	}
 	return nil
 }
 
-func (md *Mobiledoc) parseV03(
-	mdmap map[string]json.RawMessage,
-) (*node, error) {
-	root := newNode("root", "")
-
+func parseV03(mdmap map[string]json.RawMessage) (*Document, error) {
 	d, err := parseDoc(mdmap)
 	if err != nil {
-		return root, err
+		return nil, err
 	}
-	md.doc = d
 
 	sections, ok := mdmap["sections"]
 	if !ok {
-		return root, errors.New("invalid mobiledoc: sections missing")
+		return nil, errors.New("invalid mobiledoc: sections missing")
 	}
 
 	var rawSections [][]json.RawMessage
 	err = json.Unmarshal(sections, &rawSections)
 	if err != nil {
-		return root, err
+		return nil, err
 	}
 
+	document := &Document{}
 	for _, s := range rawSections {
-		if err = md.parseSection(root, s); err != nil {
-			return root, err
+		if err = d.parseSection(document, s); err != nil {
+			return nil, err
 		}
 	}
 
-	return root, nil
+	return document, nil
 }
 
-func (md *Mobiledoc) addMarkersToNode(
-	n *node, markers []json.RawMessage,
-) error {
-	nodes := []*node{n}
-	for _, m := range markers {
+// markupFrame is a markup opened by a marker and not yet closed
+type markupFrame struct {
+	markup *Markup
+	// dropped markups are not valid inline markups and are left out, but
+	// still count towards the markups a marker closes
+	dropped bool
+}
+
+// parseMarkers builds the inline content described by markers, nesting the
+// text and atoms inside the markups that are open around them.
+func (d *doc) parseMarkers(markers []json.RawMessage) ([]Inline, error) {
+	var children []Inline
+	var open []markupFrame
+
+	// appendInline adds c to the innermost markup that is open
+	appendInline := func(c Inline) {
+		for i := len(open) - 1; i >= 0; i-- {
+			if !open[i].dropped {
+				open[i].markup.Children = append(open[i].markup.Children, c)
+				return
+			}
+		}
+		children = append(children, c)
+	}
+
+	for _, raw := range markers {
 		var mark marker
-		err := json.Unmarshal(m, &mark)
+		err := json.Unmarshal(raw, &mark)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		node, openNodes, m, err := md.openMarker(n, mark)
-		if err != nil {
-			return err
+		for _, o := range mark.openIndexes {
+			if o < 0 || o >= len(d.markups) {
+				return nil, fmt.Errorf("unknown markup %d", o)
+			}
+			m := d.markups[o]
+			if !isInlineMarkup(m.tagName) {
+				open = append(open, markupFrame{dropped: true})
+				continue
+			}
+
+			markup := &Markup{Tag: strings.ToLower(m.tagName)}
+			if len(m.attributes) > 0 {
+				markup.Attributes = make(map[string]string)
+				for k, v := range m.attributes {
+					markup.Attributes[k] = v
+				}
+			}
+			appendInline(markup)
+			open = append(open, markupFrame{markup: markup})
 		}
-		nodes = append(nodes, openNodes...)
-		n = node
-		mark = m
 
 		switch mark.markerType {
 		case markerMarkup:
-			n.appendChild(newNode(TEXT, mark.value.(string)))
+			value, ok := mark.value.(string)
+			if !ok {
+				return nil, errors.New("text marker value must be a string")
+			}
+			appendInline(&TextNode{Value: value})
 		case markerAtom:
-			atom := md.doc.atoms[int(mark.value.(float64))]
-			a, err := md.renderAtom(&atom)
-			if err != nil {
-				return err
+			index, ok := mark.value.(float64)
+			if !ok || index < 0 || int(index) >= len(d.atoms) {
+				return nil, fmt.Errorf("unknown atom %v", mark.value)
 			}
-			n.appendChild(a)
+			a := d.atoms[int(index)]
+			if a.name == softReturnAtom {
+				appendInline(&BreakNode{})
+				break
+			}
+			appendInline(&AtomNode{Name: a.name, Value: a.value, Payload: a.payload})
 		}
 
-		n, nodes = md.closeMarker(n, nodes, mark)
+		if mark.closeCount > len(open) {
+			return nil, fmt.Errorf(
+				"marker closes %d markups but %d are open",
+				mark.closeCount, len(open),
+			)
+		}
+		if mark.closeCount > 0 {
+			open = open[:len(open)-mark.closeCount]
+		}
 	}
 
-	return nil
+	return children, nil
 }
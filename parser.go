@@ -18,6 +18,9 @@ const (
 	H2            = "h2"
 	H3            = "h3"
 	H4            = "h4"
+	H5            = "h5"
+	H6            = "h6"
+	ASIDE         = "aside"
 	ANCHOR        = "a"
 	IMAGE         = "img"
 	LISTITEM      = "li"
@@ -30,6 +33,7 @@ const (
 	SUBSCRIPT     = "sub"
 	SUPERSCRIPT   = "sup"
 	STRIKETHROUGH = "s"
+	BREAK         = "br"
 	TEXT          = ""
 )
 
@@ -76,12 +80,15 @@ func (m *markup) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (m *markup) createNode() *node {
-	n := newNode(m.tagName, "")
-	for k, v := range m.attributes {
-		n.addAttribute(k, v)
+// isInlineMarkup reports whether tag is a markup that may be applied to
+// text.
+func isInlineMarkup(tag string) bool {
+	switch strings.ToLower(tag) {
+	case BOLD, ITALIC, STRONG, EMPHASIS, ANCHOR, UNDERLINE,
+		SUBSCRIPT, SUPERSCRIPT, STRIKETHROUGH, CODE:
+		return true
 	}
-	return n
+	return false
 }
 
 type marker struct {
@@ -97,6 +104,9 @@ func (m *marker) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	if len(mark) < 4 {
+		return errors.New("marker too short")
+	}
 	err = json.Unmarshal(mark[0], &m.markerType)
 	if err != nil {
 		return err
@@ -115,40 +125,3 @@ func (m *marker) UnmarshalJSON(b []byte) error {
 	}
 	return nil
 }
-
-func (md Mobiledoc) openMarker(n *node, m marker) (*node, []*node, marker, error) {
-	var nodes []*node
-	for _, o := range m.openIndexes {
-		if o > len(md.doc.markups) {
-			return nil, nil, m, fmt.Errorf("unknown markup %d", o)
-		}
-
-		nodeMarkup := md.doc.markups[o]
-
-		switch strings.ToLower(nodeMarkup.tagName) {
-		case BOLD, ITALIC, STRONG, EMPHASIS, ANCHOR, UNDERLINE,
-			SUBSCRIPT, SUPERSCRIPT, STRIKETHROUGH, CODE:
-			// do nothing - valid tag
-		default:
-			m.closeCount--
-			continue
-		}
-
-		node := nodeMarkup.createNode()
-		n.appendChild(node)
-		nodes = append(nodes, node)
-		n = node
-	}
-
-	return n, nodes, m, nil
-}
-
-func (md Mobiledoc) closeMarker(
-	n *node, nodes []*node, m marker,
-) (*node, []*node) {
-	for i := 0; i < m.closeCount; i++ {
-		nodes = nodes[:len(nodes)-1]
-		n = nodes[len(nodes)-1]
-	}
-	return n, nodes
-}
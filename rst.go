@@ -0,0 +1,427 @@
+package mobiledoc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// rstHeadings maps heading tags to the character their title is underlined
+// with
+var rstHeadings = map[string]string{
+	H1: "=",
+	H2: "-",
+	H3: "~",
+	H4: "^",
+	H5: `"`,
+	H6: "'",
+}
+
+// rstCards are the cards rendered natively to reStructuredText, unless
+// replaced by a registered card of the same name
+var rstCards = map[string]Card{
+	"code": rstCodeCard,
+}
+
+// rstEscaper escapes the characters that start inline markup
+var rstEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"`", "\\`",
+	"_", `\_`,
+	"|", `\|`,
+)
+
+// rstLineStarts matches the bullets, enumerators and explicit markup start
+// that turn a line of text into a list item or a directive
+var rstLineStarts = regexp.MustCompile(
+	`^(\(?([0-9]+|[a-zA-Z#]|[ivxlcdmIVXLCDM]+)[.)]|[-+•]|\.\.)( |$)`,
+)
+
+// rstLinkEscaper escapes the characters that end the text of a hyperlink
+// reference early
+var rstLinkEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"<", `\<`,
+)
+
+// rstIndent indents every non-empty line of s.
+func rstIndent(s, indent string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rstLineBlock writes text with line breaks as a line block, as newlines
+// are only whitespace within a paragraph.
+func rstLineBlock(text string) string {
+	if !strings.Contains(text, "\n") {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = "|"
+		} else {
+			lines[i] = "| " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rstWidth returns the number of columns s takes up, counting wide East
+// Asian characters as two, which is how long a title underline must be.
+func rstWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining marks take no space
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana,
+			unicode.Hangul) ||
+			(r >= 0xff01 && r <= 0xff60) || (r >= 0x3000 && r <= 0x303f):
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+func rstCodeCard(payload interface{}) string {
+	m, ok := payload.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, _ := payloadString(m, "code")
+
+	var b strings.Builder
+	b.WriteString(".. code-block::")
+	if language, ok := payloadString(m, "language"); ok {
+		fmt.Fprintf(&b, " %s", language)
+	}
+	b.WriteString("\n")
+	if caption, ok := payloadString(m, "caption"); ok {
+		fmt.Fprintf(&b, "   :caption: %s\n", caption)
+	}
+	fmt.Fprintf(&b, "\n%s", rstIndent(code, "   "))
+	return b.String()
+}
+
+// rstWriter remembers the last character written, as inline markup is only
+// recognized after whitespace or some punctuation.
+type rstWriter struct {
+	w    io.Writer
+	last rune
+}
+
+func (w *rstWriter) write(s string) error {
+	if s == "" {
+		return nil
+	}
+	_, err := io.WriteString(w.w, s)
+	w.last, _ = utf8.DecodeLastRuneInString(s)
+	return err
+}
+
+// rstStartAllowed reports whether inline markup may start after r.
+func rstStartAllowed(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) || strings.ContainsRune(`-:/'"<([{`, r)
+}
+
+// rstEndAllowed reports whether inline markup may end before r.
+func rstEndAllowed(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) ||
+		strings.ContainsRune(`-.,:;!?\/'")]}>`, r)
+}
+
+// text returns the text of n and its descendants, with line breaks as
+// newlines.
+func (n *node) text() string {
+	if n.tagname == BREAK {
+		return n.lineBreak("\n")
+	}
+	if n.firstChild == nil {
+		return n.value
+	}
+	var b strings.Builder
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		b.WriteString(c.text())
+	}
+	return b.String()
+}
+
+// followingRune returns the first character after n within its section.
+func (n *node) followingRune() rune {
+	for p := n; p != nil && p.parent != nil; p = p.parent {
+		if p.isMarkupSection() || strings.ToLower(p.tagname) == LISTITEM {
+			break
+		}
+		for s := p.nextSibling; s != nil; s = s.nextSibling {
+			if t := s.text(); t != "" {
+				r, _ := utf8.DecodeRuneInString(t)
+				return r
+			}
+		}
+	}
+	return 0
+}
+
+// renderRSTMarkup writes the inline markup n, escaping the content with
+// escaper unless it is nil. Inline markup can not nest in reStructuredText,
+// so the content is written as plain text, and can not span the lines of a
+// line block, so each line is marked up on its own.
+func (n *node) renderRSTMarkup(
+	w *rstWriter, start, end string, escaper *strings.Replacer,
+) error {
+	content := n.text()
+	core := strings.TrimSpace(content)
+	leading := content[:strings.Index(content, core)]
+	trailing := content[len(leading)+len(core):]
+	if core == "" {
+		return w.write(content)
+	}
+	lines := strings.Split(core, "\n")
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		if text == "" {
+			continue
+		}
+		lead := line[:strings.Index(line, text)]
+		trail := line[len(lead)+len(text):]
+		if escaper != nil {
+			text = escaper.Replace(text)
+		}
+		lines[i] = lead + start + text + end + trail
+	}
+
+	if err := w.write(leading); err != nil {
+		return err
+	}
+	if !rstStartAllowed(w.last) {
+		if err := w.write(`\ `); err != nil {
+			return err
+		}
+	}
+	if err := w.write(strings.Join(lines, "\n")); err != nil {
+		return err
+	}
+	if trailing == "" && !rstEndAllowed(n.followingRune()) {
+		if err := w.write(`\ `); err != nil {
+			return err
+		}
+	}
+	return w.write(trailing)
+}
+
+// hasLink reports whether n contains a link.
+func (n *node) hasLink() bool {
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if strings.ToLower(c.tagname) == ANCHOR || c.hasLink() {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) renderRSTInline(w *rstWriter) error {
+	tag := strings.ToLower(n.tagname)
+	switch {
+	case tag == TEXT:
+		text := rstEscaper.Replace(n.value)
+		if n.startsLine() && rstLineStarts.MatchString(n.value) {
+			text = `\` + text
+		}
+		return w.write(text)
+	case tag == rawTag:
+		return w.write(n.value)
+	case tag == BREAK:
+		return w.write(n.lineBreak("\n"))
+	case tag == ANCHOR:
+		end := fmt.Sprintf(" <%s>`__", n.attributes["href"])
+		return n.renderRSTMarkup(w, "`", end, rstLinkEscaper)
+	case n.hasLink():
+		// keep the link rather than the markup around it
+	case tag == BOLD, tag == STRONG:
+		return n.renderRSTMarkup(w, "**", "**", rstEscaper)
+	case tag == ITALIC, tag == EMPHASIS:
+		return n.renderRSTMarkup(w, "*", "*", rstEscaper)
+	case tag == CODE:
+		return n.renderRSTMarkup(w, "``", "``", nil)
+	case tag == SUBSCRIPT:
+		return n.renderRSTMarkup(w, ":sub:`", "`", rstEscaper)
+	case tag == SUPERSCRIPT:
+		return n.renderRSTMarkup(w, ":sup:`", "`", rstEscaper)
+	}
+
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if err := c.renderRSTInline(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rstInline returns the inline content of n.
+func (n *node) rstInline() (string, error) {
+	var b bytes.Buffer
+	w := &rstWriter{w: &b}
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		if c.isList() {
+			break
+		}
+		if err := c.renderRSTInline(w); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// renderRSTList writes the list n with its items indented by indent.
+func (n *node) renderRSTList(w io.Writer, indent string) error {
+	for li := n.firstChild; li != nil; li = li.nextSibling {
+		marker := li.listMarker()
+		text, err := li.rstInline()
+		if err != nil {
+			return err
+		}
+		// the lines of a line block continue the item
+		text = strings.ReplaceAll(
+			rstLineBlock(text), "\n", "\n"+indent+strings.Repeat(" ", len(marker)),
+		)
+		if _, err = fmt.Fprintf(w, "%s%s%s\n", indent, marker, text); err != nil {
+			return err
+		}
+
+		if nested := li.lastChild; nested.isList() {
+			if _, err = fmt.Fprint(w, "\n"); err != nil {
+				return err
+			}
+			nestedIndent := indent + strings.Repeat(" ", len(marker))
+			if err = nested.renderRSTList(w, nestedIndent); err != nil {
+				return err
+			}
+			if li.nextSibling != nil {
+				if _, err = fmt.Fprint(w, "\n"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// renderRSTImage writes the directive of an image, which is a figure when it
+// has a caption, or the definition of its substitution.
+func (n *node) renderRSTImage(w io.Writer, substitution string) error {
+	caption, hasCaption := n.attributes["caption"]
+	directive := "image"
+	switch {
+	case substitution != "":
+		directive = "|" + substitution + "| image"
+	case hasCaption:
+		directive = "figure"
+	}
+
+	_, err := fmt.Fprintf(w, ".. %s:: %s\n", directive, n.attributes["src"])
+	if err != nil {
+		return err
+	}
+	for _, k := range []string{"alt", "width", "height"} {
+		if v, ok := n.attributes[k]; ok {
+			if _, err = fmt.Fprintf(w, "   :%s: %s\n", k, v); err != nil {
+				return err
+			}
+		}
+	}
+	if hasCaption && substitution == "" {
+		_, err = fmt.Fprintf(w, "\n   %s\n", rstEscaper.Replace(caption))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprint(w, "\n")
+	return err
+}
+
+// renderRSTSection writes a section of the document.
+func (n *node) renderRSTSection(w io.Writer) error {
+	var err error
+	tag := strings.ToLower(n.tagname)
+	switch {
+	case n.tagname == cardTag:
+		_, err = fmt.Fprintf(w, "%s\n\n", strings.TrimRight(n.text(), "\n"))
+		return err
+	case tag == IMAGE:
+		return n.renderRSTImage(w, "")
+	case n.isList():
+		if err = n.renderRSTList(w, ""); err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, "\n")
+		return err
+	}
+
+	if align := n.attributes[textAlignAttribute]; textAlignments[align] {
+		if _, err = fmt.Fprintf(w, ".. class:: text-%s\n\n", align); err != nil {
+			return err
+		}
+	}
+
+	text, err := n.rstInline()
+	if err != nil {
+		return err
+	}
+	switch tag {
+	case H1, H2, H3, H4, H5, H6:
+		underline := strings.Repeat(rstHeadings[tag], rstWidth(text))
+		_, err = fmt.Fprintf(w, "%s\n%s\n\n", text, underline)
+	case BLOCKQUOTE, ASIDE:
+		// an empty comment ends an indented block before the quote, so it
+		// does not become part of that block
+		if n.prevSibling != nil && !n.prevSibling.isMarkupSection() {
+			if _, err = fmt.Fprint(w, "..\n\n"); err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(w, "%s\n\n", rstIndent(rstLineBlock(text), "   "))
+	default:
+		_, err = fmt.Fprintf(w, "%s\n\n", rstLineBlock(text))
+	}
+	return err
+}
+
+// renderRST writes the document. Images without a caption are written as
+// substitutions, defined at the end of the document, while captioned ones
+// need a figure.
+func (n *node) renderRST(w io.Writer) error {
+	var images []*node
+	for c := n.firstChild; c != nil; c = c.nextSibling {
+		_, hasCaption := c.attributes["caption"]
+		if strings.ToLower(c.tagname) == IMAGE && !hasCaption {
+			images = append(images, c)
+			if _, err := fmt.Fprintf(w, "|image%d|\n\n", len(images)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.renderRSTSection(w); err != nil {
+			return err
+		}
+	}
+	for i, image := range images {
+		if err := image.renderRSTImage(w, fmt.Sprintf("image%d", i+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
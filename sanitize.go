@@ -0,0 +1,375 @@
+package mobiledoc
+
+import (
+	"html"
+	"strings"
+)
+
+// Sanitizer cleans up HTML written by users before it is rendered
+type Sanitizer interface {
+	Sanitize(html string) (string, error)
+}
+
+// SanitizerFunc adapts a function to a Sanitizer
+type SanitizerFunc func(html string) (string, error)
+
+// Sanitize calls fn
+func (fn SanitizerFunc) Sanitize(html string) (string, error) {
+	return fn(html)
+}
+
+// AllowlistSanitizer is the default Sanitizer. It keeps only the allowed
+// elements and attributes, leaving out the text of scripts, styles and
+// other elements whose content is not text, and closes the elements left
+// open. Links and images are kept only for http, https, mailto and tel
+// URLs, or relative ones.
+type AllowlistSanitizer struct {
+	// Elements maps the allowed elements to their allowed attributes, with
+	// the attributes under "*" allowed for every element. DefaultAllowlist
+	// is used when nil.
+	Elements map[string][]string
+}
+
+// DefaultAllowlist returns the elements and attributes kept by an
+// AllowlistSanitizer by default, which are those for formatted text, links,
+// images and tables
+func DefaultAllowlist() map[string][]string {
+	return map[string][]string{
+		"*":          {"class", "title"},
+		"a":          {"href", "rel", "target"},
+		"abbr":       nil,
+		"b":          nil,
+		"blockquote": {"cite"},
+		"br":         nil,
+		"caption":    nil,
+		"code":       nil,
+		"dd":         nil,
+		"del":        nil,
+		"div":        nil,
+		"dl":         nil,
+		"dt":         nil,
+		"em":         nil,
+		"figcaption": nil,
+		"figure":     nil,
+		"h1":         nil,
+		"h2":         nil,
+		"h3":         nil,
+		"h4":         nil,
+		"h5":         nil,
+		"h6":         nil,
+		"hr":         nil,
+		"i":          nil,
+		"img":        {"src", "alt", "width", "height"},
+		"ins":        nil,
+		"kbd":        nil,
+		"li":         nil,
+		"mark":       nil,
+		"ol":         {"start"},
+		"p":          nil,
+		"pre":        nil,
+		"q":          {"cite"},
+		"s":          nil,
+		"small":      nil,
+		"span":       nil,
+		"strong":     nil,
+		"sub":        nil,
+		"sup":        nil,
+		"table":      nil,
+		"tbody":      nil,
+		"td":         {"colspan", "rowspan"},
+		"tfoot":      nil,
+		"th":         {"colspan", "rowspan", "scope"},
+		"thead":      nil,
+		"tr":         nil,
+		"u":          nil,
+		"ul":         nil,
+	}
+}
+
+// rawTextElements hold text up to their end tag rather than markup
+var rawTextElements = map[string]bool{
+	"iframe": true, "noembed": true, "noframes": true, "noscript": true,
+	"plaintext": true, "script": true, "style": true, "textarea": true,
+	"title": true, "xmp": true,
+}
+
+// voidElements have no content and no end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// urlAttributes hold a URL
+var urlAttributes = map[string]bool{
+	"action": true, "background": true, "cite": true, "formaction": true,
+	"href": true, "longdesc": true, "poster": true, "src": true,
+}
+
+// safeURL reports whether the URL u has no scheme or one that can not run
+// scripts. Browsers ignore whitespace and control characters within the
+// scheme, so they are left out before it is checked.
+func safeURL(u string) bool {
+	var b strings.Builder
+	for _, r := range u {
+		if r > ' ' && r != 0x7f {
+			b.WriteRune(r)
+		}
+	}
+	u = strings.ToLower(b.String())
+
+	colon := strings.IndexByte(u, ':')
+	if colon < 0 || strings.ContainsAny(u[:colon], "/?#") {
+		return true
+	}
+	switch u[:colon] {
+	case "http", "https", "mailto", "tel":
+		return true
+	}
+	return false
+}
+
+// dropUnsafeURLs removes the URLs of n and its descendants, such as the
+// links and image sources written by the renderers, that could run scripts.
+// Images left without a source are removed altogether.
+func (n *node) dropUnsafeURLs() {
+	for k, v := range n.attributes {
+		if urlAttributes[k] && !safeURL(v) {
+			delete(n.attributes, k)
+		}
+	}
+	for c := n.firstChild; c != nil; {
+		next := c.nextSibling
+		c.dropUnsafeURLs()
+		if _, ok := c.attributes["src"]; !ok && strings.ToLower(c.tagname) == IMAGE {
+			n.removeChild(c)
+		}
+		c = next
+	}
+}
+
+// tagKind is the kind of markup found at a <
+type tagKind int
+
+const (
+	// notTag is a < that starts no markup, written as text
+	notTag tagKind = iota
+	// ignoredTag is a comment, doctype, processing instruction or a tag cut
+	// short by the end of the input
+	ignoredTag
+	startTag
+	endTag
+)
+
+// tag is an HTML tag with its lower case name and its attributes in order
+type tag struct {
+	kind       tagKind
+	name       string
+	attributes [][2]string
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// isNameEnd reports whether c ends a tag or attribute name.
+func isNameEnd(c byte) bool {
+	return isHTMLSpace(c) || c == '/' || c == '>'
+}
+
+// nextTag reads the markup starting with the < at the start of s,
+// returning it and its length.
+func nextTag(s string) (tag, int) {
+	switch {
+	case strings.HasPrefix(s, "<!--"):
+		if end := strings.Index(s[4:], "-->"); end >= 0 {
+			return tag{kind: ignoredTag}, 4 + end + 3
+		}
+		return tag{kind: ignoredTag}, len(s)
+	case len(s) > 1 && (s[1] == '!' || s[1] == '?' || s[1] == '/') &&
+		(len(s) < 3 || s[1] != '/' || !isASCIILetter(s[2])):
+		// bogus comments run to the next >
+		if end := strings.IndexByte(s, '>'); end >= 0 {
+			return tag{kind: ignoredTag}, end + 1
+		}
+		return tag{kind: ignoredTag}, len(s)
+	case len(s) > 2 && s[1] == '/':
+		i := 2
+		for i < len(s) && !isNameEnd(s[i]) {
+			i++
+		}
+		name := strings.ToLower(s[2:i])
+		if end := strings.IndexByte(s[i:], '>'); end >= 0 {
+			return tag{kind: endTag, name: name}, i + end + 1
+		}
+		return tag{kind: ignoredTag}, len(s)
+	case len(s) > 1 && isASCIILetter(s[1]):
+		return startTagAt(s)
+	}
+	return tag{kind: notTag}, 1
+}
+
+// startTagAt reads the start tag at the start of s.
+func startTagAt(s string) (tag, int) {
+	i := 1
+	for i < len(s) && !isNameEnd(s[i]) {
+		i++
+	}
+	t := tag{kind: startTag, name: strings.ToLower(s[1:i])}
+	seen := make(map[string]bool)
+
+	for i < len(s) {
+		if isHTMLSpace(s[i]) || s[i] == '/' {
+			i++
+			continue
+		}
+		if s[i] == '>' {
+			return t, i + 1
+		}
+
+		start := i
+		i++ // a name may start with =
+		for i < len(s) && !isNameEnd(s[i]) && s[i] != '=' {
+			i++
+		}
+		name := strings.ToLower(s[start:i])
+		for i < len(s) && isHTMLSpace(s[i]) {
+			i++
+		}
+
+		var value string
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isHTMLSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				end := strings.IndexByte(s[i+1:], s[i])
+				if end < 0 {
+					break
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+
+		// the first of repeated attributes is the one used
+		if !seen[name] {
+			seen[name] = true
+			t.attributes = append(t.attributes, [2]string{name, html.UnescapeString(value)})
+		}
+	}
+	return tag{kind: ignoredTag}, len(s)
+}
+
+// rawTextEnd returns the index of the end tag of the raw text element name
+// in s, or the length of s when it is not closed.
+func rawTextEnd(s, name string) int {
+	for i := 0; ; {
+		n := strings.Index(s[i:], "</")
+		if n < 0 {
+			return len(s)
+		}
+		i += n
+		end := i + 2 + len(name)
+		if end <= len(s) && strings.EqualFold(s[i+2:end], name) &&
+			(end == len(s) || isNameEnd(s[end])) {
+			return i
+		}
+		i += 2
+	}
+}
+
+// Sanitize returns the allowed elements and the text of s
+func (a AllowlistSanitizer) Sanitize(s string) (string, error) {
+	allowed := a.Elements
+	if allowed == nil {
+		allowed = DefaultAllowlist()
+	}
+
+	var b strings.Builder
+	var open []string
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			n := strings.IndexByte(s[i:], '<')
+			if n < 0 {
+				n = len(s) - i
+			}
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+
+		t, n := nextTag(s[i:])
+		i += n
+		attributes, ok := allowed[t.name]
+
+		switch t.kind {
+		case notTag:
+			b.WriteString("&lt;")
+		case startTag:
+			var text string
+			if rawTextElements[t.name] {
+				end := rawTextEnd(s[i:], t.name)
+				text = s[i : i+end]
+				i += end
+			}
+			if !ok {
+				break
+			}
+
+			b.WriteString("<" + t.name)
+			for _, attr := range t.attributes {
+				if !allowedAttribute(attr[0], attributes, allowed["*"]) ||
+					(urlAttributes[attr[0]] && !safeURL(attr[1])) {
+					continue
+				}
+				b.WriteString(" " + attr[0] + `="` + html.EscapeString(attr[1]) + `"`)
+			}
+			b.WriteString(">" + text)
+			if !voidElements[t.name] {
+				open = append(open, t.name)
+			}
+		case endTag:
+			if !ok {
+				break
+			}
+			// closing an element closes those opened within it
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j] != t.name {
+					continue
+				}
+				for ; len(open) > j; open = open[:len(open)-1] {
+					b.WriteString("</" + open[len(open)-1] + ">")
+				}
+				break
+			}
+		}
+	}
+	for j := len(open) - 1; j >= 0; j-- {
+		b.WriteString("</" + open[j] + ">")
+	}
+	return b.String(), nil
+}
+
+// allowedAttribute reports whether name is in either list of attributes.
+func allowedAttribute(name string, attributes, global []string) bool {
+	for _, list := range [][]string{attributes, global} {
+		for _, a := range list {
+			if a == name {
+				return true
+			}
+		}
+	}
+	return false
+}
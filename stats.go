@@ -0,0 +1,138 @@
+package mobiledoc
+
+import (
+	"math"
+	"time"
+	"unicode"
+)
+
+// StatsOptions configures the reading time estimated by Statistics. The
+// defaults are those used by Ghost.
+type StatsOptions struct {
+	// WordsPerMinute is the reading speed, 275 when 0
+	WordsPerMinute int
+	// ImageSeconds is the time spent on the first image, 12 when 0. Each
+	// following image takes a second less, down to MinImageSeconds.
+	ImageSeconds int
+	// MinImageSeconds is the least time spent on an image, 3 when 0
+	MinImageSeconds int
+}
+
+func (o StatsOptions) withDefaults() StatsOptions {
+	if o.WordsPerMinute <= 0 {
+		o.WordsPerMinute = 275
+	}
+	if o.ImageSeconds <= 0 {
+		o.ImageSeconds = 12
+	}
+	if o.MinImageSeconds <= 0 {
+		o.MinImageSeconds = 3
+	}
+	return o
+}
+
+// Stats are the counts of the content of a document
+type Stats struct {
+	// Words counts the words of the text, with each Chinese or Japanese
+	// character counted as a word
+	Words int
+	// Characters counts the characters of the text other than whitespace
+	Characters int
+	// Images counts image sections, image cards and the images of galleries
+	Images int
+	// Headings counts the h1 to h6 sections
+	Headings int
+	// Cards and Atoms count the cards and atoms by name
+	Cards map[string]int
+	Atoms map[string]int
+	// ReadingTime is the estimated time taken to read the text and look at
+	// the images
+	ReadingTime time.Duration
+}
+
+// ReadingMinutes returns the reading time rounded to minutes, with any
+// content taking at least a minute
+func (s Stats) ReadingMinutes() int {
+	minutes := int(math.Round(s.ReadingTime.Minutes()))
+	if minutes == 0 && s.ReadingTime > 0 {
+		return 1
+	}
+	return minutes
+}
+
+// isIdeograph reports whether r is written without spaces between words.
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// countText returns the number of words and characters in text.
+func countText(text string) (words, characters int) {
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+			continue
+		case isIdeograph(r):
+			words++
+			inWord = false
+		case !inWord && (unicode.IsLetter(r) || unicode.IsNumber(r)):
+			words++
+			inWord = true
+		}
+		characters++
+	}
+	return words, characters
+}
+
+// Statistics returns the counts of the content of the document, using the
+// options to estimate the reading time
+func Statistics(d *Document, opts StatsOptions) Stats {
+	opts = opts.withDefaults()
+	s := Stats{Cards: make(map[string]int), Atoms: make(map[string]int)}
+
+	// count adds the text of inlines
+	count := func(inlines []Inline) {
+		words, characters := countText(inlineText(inlines))
+		s.Words += words
+		s.Characters += characters
+	}
+
+	_ = Walk(d, VisitorFuncs{EnterFunc: func(e Element) error {
+		switch e := e.(type) {
+		case *MarkupSection:
+			if headingLevel(e.Tag) > 0 {
+				s.Headings++
+			}
+			count(e.Children)
+		case *ListItem:
+			count(e.Children)
+		case *ImageSection:
+			s.Images++
+		case *CardSection:
+			s.Cards[e.Name]++
+			switch e.Name {
+			case "image", "image-card":
+				s.Images++
+			case "gallery":
+				m, _ := e.Payload.(map[string]interface{})
+				images, _ := m["images"].([]interface{})
+				s.Images += len(images)
+			}
+		case *AtomNode:
+			s.Atoms[e.Name]++
+		}
+		return nil
+	}})
+
+	seconds := float64(s.Words) / float64(opts.WordsPerMinute) * 60
+	for i := 0; i < s.Images; i++ {
+		image := opts.ImageSeconds - i
+		if image < opts.MinImageSeconds {
+			image = opts.MinImageSeconds
+		}
+		seconds += float64(image)
+	}
+	s.ReadingTime = time.Duration(seconds * float64(time.Second))
+	return s
+}
@@ -0,0 +1,146 @@
+package mobiledoc
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template renders cards and atoms from a template. Templates from both
+// text/template and html/template satisfy it.
+type Template interface {
+	Name() string
+	Execute(w io.Writer, data interface{}) error
+}
+
+// CardData is the data card templates are executed with
+type CardData struct {
+	// Name of the card
+	Name string
+	// Payload of the card as decoded from JSON
+	Payload interface{}
+	// Format the document is being rendered to
+	Format Format
+}
+
+// AtomData is the data atom templates are executed with
+type AtomData struct {
+	// Name of the atom
+	Name string
+	// Value is the text of the atom
+	Value string
+	// Payload of the atom as decoded from JSON
+	Payload interface{}
+	// Format the document is being rendered to
+	Format Format
+}
+
+func templateCard(t Template) cardRenderer {
+	return func(c *card, format Format) (string, error) {
+		var b strings.Builder
+		err := t.Execute(&b, CardData{
+			Name:    c.name,
+			Payload: c.payload,
+			Format:  format,
+		})
+		return b.String(), err
+	}
+}
+
+func templateAtom(t Template) atomRenderer {
+	return func(a *atom, format Format) (string, error) {
+		var b strings.Builder
+		err := t.Execute(&b, AtomData{
+			Name:    a.name,
+			Value:   a.value,
+			Payload: a.payload,
+			Format:  format,
+		})
+		return b.String(), err
+	}
+}
+
+// WithCardTemplate creates a new Mobiledoc instance that renders the named
+// card with a template
+func (md Mobiledoc) WithCardTemplate(name string, t Template) Mobiledoc {
+	return md.withCard(name, templateCard(t))
+}
+
+// WithAtomTemplate creates a new Mobiledoc instance that renders the named
+// atom with a template
+func (md Mobiledoc) WithAtomTemplate(name string, t Template) Mobiledoc {
+	return md.withAtom(name, templateAtom(t))
+}
+
+// WithFormatCardTemplate creates a new Mobiledoc instance that renders the
+// named card with a template for a single format
+func (md Mobiledoc) WithFormatCardTemplate(
+	format Format, name string, t Template,
+) Mobiledoc {
+	return md.withFormatCard(format, name, templateCard(t))
+}
+
+// WithFormatAtomTemplate creates a new Mobiledoc instance that renders the
+// named atom with a template for a single format
+func (md Mobiledoc) WithFormatAtomTemplate(
+	format Format, name string, t Template,
+) Mobiledoc {
+	return md.withFormatAtom(format, name, templateAtom(t))
+}
+
+// templateName returns the card or atom name for a template file, which is
+// the file name without its extension.
+func templateName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// parseTemplates parses every file matching pattern with parse.
+func parseTemplates(
+	pattern string, parse func(name, src string) (Template, error),
+) (map[string]Template, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no template files match %q", pattern)
+	}
+
+	templates := make(map[string]Template)
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := templateName(file)
+		t, err := parse(name, string(b))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse template %s: %w", file, err)
+		}
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+// ParseTextTemplates parses the text/template files matching the pattern,
+// keyed by the file name without its extension, such as "code" for
+// cards/code.tmpl.
+func ParseTextTemplates(pattern string) (map[string]Template, error) {
+	return parseTemplates(pattern, func(name, src string) (Template, error) {
+		return texttemplate.New(name).Parse(src)
+	})
+}
+
+// ParseHTMLTemplates parses the html/template files matching the pattern,
+// keyed by the file name without its extension, such as "code" for
+// cards/code.html.
+func ParseHTMLTemplates(pattern string) (map[string]Template, error) {
+	return parseTemplates(pattern, func(name, src string) (Template, error) {
+		return htmltemplate.New(name).Parse(src)
+	})
+}
@@ -0,0 +1,172 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Heading is a heading of a document along with the headings below it
+type Heading struct {
+	Level int
+	Text  string
+	ID    string
+	// Section is the index of the heading in the sections of the document
+	Section  int
+	Children []*Heading
+}
+
+// SlugFunc generates the ID of a heading from its text
+type SlugFunc func(text string) string
+
+// Slugify is the default SlugFunc. It lower cases the text, keeping letters,
+// digits and underscores, and joins the words with hyphens.
+func Slugify(text string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '_':
+			if hyphen && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r), r == '-':
+			hyphen = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// headingLevel returns the level of a heading tag, or 0 for other tags.
+func headingLevel(tag string) int {
+	switch tag {
+	case H1, H2, H3, H4, H5, H6:
+		return int(tag[1] - '0')
+	}
+	return 0
+}
+
+// Headings returns the hierarchy of the headings of the document, with IDs
+// generated by slug, or Slugify when nil. Repeated IDs are numbered, so that
+// the second "intro" becomes "intro-1".
+//
+// A heading is placed below the closest heading before it with a lower
+// level.
+func Headings(d *Document, slug SlugFunc) []*Heading {
+	if slug == nil {
+		slug = Slugify
+	}
+
+	var roots, open []*Heading
+	used := make(map[string]bool)
+	for i, s := range d.Sections {
+		m, ok := s.(*MarkupSection)
+		if !ok {
+			continue
+		}
+		level := headingLevel(m.Tag)
+		if level == 0 {
+			continue
+		}
+
+		text := strings.TrimSpace(inlineText(m.Children))
+		id := slug(text)
+		for n := 1; used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", slug(text), n)
+		}
+		used[id] = true
+		h := &Heading{Level: level, Text: text, ID: id, Section: i}
+
+		for len(open) > 0 && open[len(open)-1].Level >= level {
+			open = open[:len(open)-1]
+		}
+		if len(open) == 0 {
+			roots = append(roots, h)
+		} else {
+			parent := open[len(open)-1]
+			parent.Children = append(parent.Children, h)
+		}
+		open = append(open, h)
+	}
+	return roots
+}
+
+// headingIDs returns the IDs of the headings of d by section index.
+func headingIDs(d *Document, slug SlugFunc) map[int]string {
+	ids := make(map[int]string)
+	var add func(headings []*Heading)
+	add = func(headings []*Heading) {
+		for _, h := range headings {
+			ids[h.Section] = h.ID
+			add(h.Children)
+		}
+	}
+	add(Headings(d, slug))
+	return ids
+}
+
+// RenderTOC writes a table of contents linking to the headings as a nested
+// list in Markdown or HTML
+func RenderTOC(w io.Writer, headings []*Heading, format Format) error {
+	switch format {
+	case Markdown:
+		return renderMarkdownTOC(w, headings, "")
+	case HTML:
+		return renderHTMLTOC(w, headings)
+	}
+	return fmt.Errorf("unsupported table of contents format %s", format)
+}
+
+func renderMarkdownTOC(w io.Writer, headings []*Heading, indent string) error {
+	escaper := strings.NewReplacer("[", `\[`, "]", `\]`)
+	for _, h := range headings {
+		_, err := fmt.Fprintf(
+			w, "%s* [%s](#%s)\n", indent, escaper.Replace(h.Text), h.ID,
+		)
+		if err != nil {
+			return err
+		}
+		if err = renderMarkdownTOC(w, h.Children, indent+"  "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderHTMLTOC(w io.Writer, headings []*Heading) error {
+	if len(headings) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprint(w, "<ul>\n"); err != nil {
+		return err
+	}
+	for _, h := range headings {
+		_, err := fmt.Fprintf(
+			w, `<li><a href="#%s">%s</a>`,
+			html.EscapeString(h.ID), html.EscapeString(h.Text),
+		)
+		if err != nil {
+			return err
+		}
+		if len(h.Children) > 0 {
+			if _, err = fmt.Fprint(w, "\n"); err != nil {
+				return err
+			}
+			if err = renderHTMLTOC(w, h.Children); err != nil {
+				return err
+			}
+		}
+		if _, err = fmt.Fprint(w, "</li>\n"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "</ul>\n")
+	return err
+}
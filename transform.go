@@ -0,0 +1,168 @@
+package mobiledoc
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Transform rewrites a Document between parsing and rendering
+type Transform func(d *Document) error
+
+// WithTransform creates a new Mobiledoc instance that applies the given
+// transforms, after any already added, before rendering. Documents given to
+// RenderDocument are copied first, so the transforms do not change them.
+func (md Mobiledoc) WithTransform(transforms ...Transform) Mobiledoc {
+	all := make([]Transform, 0, len(md.transforms)+len(transforms))
+	all = append(all, md.transforms...)
+	md.transforms = append(all, transforms...)
+	return md
+}
+
+// transform applies the transforms of md to d in order
+func (md *Mobiledoc) transform(d *Document) error {
+	for i, t := range md.transforms {
+		if err := t(d); err != nil {
+			return fmt.Errorf("unable to apply transform %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ReplaceImageHost returns a Transform that moves the images of image
+// sections and image cards hosted on from to the host to
+func ReplaceImageHost(from, to string) Transform {
+	replace := func(src string) string {
+		u, err := url.Parse(src)
+		if err != nil || !strings.EqualFold(u.Host, from) {
+			return src
+		}
+		u.Host = to
+		return u.String()
+	}
+
+	return func(d *Document) error {
+		return Walk(d, VisitorFuncs{EnterFunc: func(e Element) error {
+			switch e := e.(type) {
+			case *ImageSection:
+				e.Src = replace(e.Src)
+			case *CardSection:
+				if _, ok := builtinCards[e.Name]; !ok {
+					break
+				}
+				m, ok := e.Payload.(map[string]interface{})
+				if !ok {
+					break
+				}
+				if src, ok := m["src"].(string); ok {
+					m["src"] = replace(src)
+				}
+			}
+			return SkipChildren
+		}})
+	}
+}
+
+// StripEmptyParagraphs is a Transform that removes paragraphs containing
+// nothing but whitespace
+func StripEmptyParagraphs(d *Document) error {
+	sections := d.Sections[:0]
+	for _, s := range d.Sections {
+		if p, ok := s.(*MarkupSection); ok && p.Tag == PARAGRAPH &&
+			isBlank(p.Children) {
+			continue
+		}
+		sections = append(sections, s)
+	}
+	d.Sections = sections
+	return nil
+}
+
+// isBlank reports whether inlines contain no atoms and only whitespace text
+// and line breaks.
+func isBlank(inlines []Inline) bool {
+	for _, i := range inlines {
+		switch i := i.(type) {
+		case *TextNode:
+			if strings.TrimSpace(i.Value) != "" {
+				return false
+			}
+		case *Markup:
+			if !isBlank(i.Children) {
+				return false
+			}
+		case *BreakNode:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// DemoteHeadings returns a Transform that moves headings down by levels,
+// stopping at h6, so that h1 becomes h2 when levels is 1
+func DemoteHeadings(levels int) Transform {
+	return func(d *Document) error {
+		for _, s := range d.Sections {
+			h, ok := s.(*MarkupSection)
+			if !ok || len(h.Tag) != 2 || h.Tag[0] != 'h' ||
+				h.Tag[1] < '1' || h.Tag[1] > '6' {
+				continue
+			}
+			level := int(h.Tag[1]-'0') + levels
+			if level > 6 {
+				level = 6
+			}
+			if level < 1 {
+				level = 1
+			}
+			h.Tag = fmt.Sprintf("h%d", level)
+		}
+		return nil
+	}
+}
+
+// MergeMarkups is a Transform that joins adjacent markups with the same tag
+// and attributes, such as two bold runs next to each other, into one
+func MergeMarkups(d *Document) error {
+	return Walk(d, VisitorFuncs{EnterFunc: func(e Element) error {
+		switch e := e.(type) {
+		case *MarkupSection:
+			e.Children = mergeMarkups(e.Children)
+		case *ListItem:
+			e.Children = mergeMarkups(e.Children)
+		case *Markup:
+			e.Children = mergeMarkups(e.Children)
+		}
+		return nil
+	}})
+}
+
+func mergeMarkups(inlines []Inline) []Inline {
+	merged := inlines[:0]
+	for _, i := range inlines {
+		if len(merged) > 0 {
+			prev, ok := merged[len(merged)-1].(*Markup)
+			m, ok2 := i.(*Markup)
+			if ok && ok2 && sameMarkup(prev, m) {
+				prev.Children = append(prev.Children, m.Children...)
+				continue
+			}
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
+
+// sameMarkup reports whether a and b have the same tag and attributes.
+func sameMarkup(a, b *Markup) bool {
+	if a.Tag != b.Tag || len(a.Attributes) != len(b.Attributes) {
+		return false
+	}
+	for k, v := range a.Attributes {
+		if bv, ok := b.Attributes[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package mobiledoc
+
+import "errors"
+
+// Element is any part of a Document: a Section, a *ListItem or an Inline
+type Element interface {
+	element()
+}
+
+func (*MarkupSection) element() {}
+func (*ListSection) element()   {}
+func (*ListItem) element()      {}
+func (*ImageSection) element()  {}
+func (*CardSection) element()   {}
+func (*TextNode) element()      {}
+func (*Markup) element()        {}
+func (*AtomNode) element()      {}
+func (*BreakNode) element()     {}
+
+// Errors returned by a Visitor to control the walk
+var (
+	// SkipChildren returned by Enter skips the children of the element.
+	// Leave is still called for the element.
+	SkipChildren = errors.New("skip children")
+	// Stop ends the walk without Walk returning an error
+	Stop = errors.New("stop walk")
+)
+
+// Visitor is called by Walk when entering and leaving each element.
+//
+// Returning SkipChildren or Stop controls the walk, while returning any other
+// error ends it with the error.
+type Visitor interface {
+	Enter(e Element) error
+	Leave(e Element) error
+}
+
+// VisitorFuncs is a Visitor calling its functions, which may be nil
+type VisitorFuncs struct {
+	EnterFunc func(e Element) error
+	LeaveFunc func(e Element) error
+}
+
+// Enter calls EnterFunc
+func (v VisitorFuncs) Enter(e Element) error {
+	if v.EnterFunc == nil {
+		return nil
+	}
+	return v.EnterFunc(e)
+}
+
+// Leave calls LeaveFunc
+func (v VisitorFuncs) Leave(e Element) error {
+	if v.LeaveFunc == nil {
+		return nil
+	}
+	return v.LeaveFunc(e)
+}
+
+// Walk visits the sections of the document in order, depth first, calling
+// Enter before the children of an element and Leave after them.
+//
+// List items are visited with their text before their nested lists.
+func Walk(d *Document, v Visitor) error {
+	for _, s := range d.Sections {
+		if err := walk(s, v); err != nil {
+			if err == Stop {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func walk(e Element, v Visitor) error {
+	err := v.Enter(e)
+	if err == SkipChildren {
+		return leave(e, v)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch e := e.(type) {
+	case *MarkupSection:
+		err = walkInlines(e.Children, v)
+	case *ListSection:
+		for _, item := range e.Items {
+			if err = walk(item, v); err != nil {
+				break
+			}
+		}
+	case *ListItem:
+		if err = walkInlines(e.Children, v); err != nil {
+			break
+		}
+		for _, l := range e.Lists {
+			if err = walk(l, v); err != nil {
+				break
+			}
+		}
+	case *Markup:
+		err = walkInlines(e.Children, v)
+	}
+	if err != nil {
+		return err
+	}
+
+	return leave(e, v)
+}
+
+// leave calls Leave for e, where SkipChildren has no meaning
+func leave(e Element, v Visitor) error {
+	if err := v.Leave(e); err != SkipChildren {
+		return err
+	}
+	return nil
+}
+
+func walkInlines(inlines []Inline, v Visitor) error {
+	for _, i := range inlines {
+		if err := walk(i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}